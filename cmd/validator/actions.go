@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/enterprisesight/es-license-validator/pkg/phonehome"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// licenseUpdateTimeout bounds writing a renewed license into the Secret
+const licenseUpdateTimeout = 30 * time.Second
+
+// handlePhoneHomeResponse applies the actions a license server pushed back in
+// its response to a phone home request
+func (s *ValidatorService) handlePhoneHomeResponse(req phonehome.PhoneHomeRequest, resp *phonehome.PhoneHomeResponse) {
+	if !resp.ServerTime.IsZero() {
+		s.clock.Observe("license_server", resp.ServerTime)
+	}
+
+	if resp.License != "" {
+		if err := s.applyRenewedLicense(req.LicenseID, resp.License); err != nil {
+			slog.Error("Failed to apply renewed license from license server",
+				"license_id", req.LicenseID, "error", err)
+		}
+	}
+
+	if resp.RevocationList != "" {
+		s.applyPushedRevocationList(resp.RevocationList)
+	}
+
+	if resp.CheckIn != nil {
+		s.phoneHomeScheduler.SetCheckIn(req.LicenseID, *resp.CheckIn)
+		slog.Info("License server updated phone home parameters", "license_id", req.LicenseID)
+
+		// Reschedule with the new parameters
+		select {
+		case s.phoneHomeCheck <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// applyRenewedLicense verifies a renewed license JWT and writes it over the
+// license it renews in the license Secret. The Secret watch then triggers a
+// revalidation.
+func (s *ValidatorService) applyRenewedLicense(licenseID, licenseJWT string) error {
+	renewed, err := s.validator.Verify(licenseJWT)
+	if err != nil {
+		return fmt.Errorf("renewed license failed verification: %w", err)
+	}
+	if renewed.LicenseID != licenseID {
+		return fmt.Errorf("renewed license is for license %q, not %q", renewed.LicenseID, licenseID)
+	}
+
+	secret, err := s.secretWatcher.Get()
+	if err != nil {
+		return fmt.Errorf("failed to read license secret: %w", err)
+	}
+
+	// Find the Secret key holding the license being renewed
+	for _, key := range licenseKeys(secret.Data, s.cfg.LicenseSecretKey) {
+		current, err := s.validator.Verify(string(secret.Data[key]))
+		if err != nil || current.LicenseID != licenseID {
+			continue
+		}
+		if string(secret.Data[key]) == licenseJWT {
+			return nil // already applied
+		}
+		if renewed.ExpiresAt.Before(current.ExpiresAt) {
+			return fmt.Errorf("renewed license expires %s, before the current license (%s)",
+				renewed.ExpiresAt.Format(time.RFC3339), current.ExpiresAt.Format(time.RFC3339))
+		}
+
+		patch, err := json.Marshal(map[string]interface{}{
+			"data": map[string][]byte{
+				key: []byte(licenseJWT),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to marshal license patch: %w", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), licenseUpdateTimeout)
+		defer cancel()
+		_, err = s.k8sClient.CoreV1().Secrets(secret.Namespace).Patch(ctx, secret.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to patch license secret: %w", err)
+		}
+
+		slog.Info("Applied renewed license from license server",
+			"license_id", licenseID, "secret_key", key,
+			"expires_at", renewed.ExpiresAt.Format(time.RFC3339))
+		return nil
+	}
+
+	return fmt.Errorf("no license %q found in secret", licenseID)
+}
+
+// applyPushedRevocationList applies a revocation list the license server
+// pushed with its response and caches it like a fetched one; the list takes
+// effect on the next validation, which is triggered right away
+func (s *ValidatorService) applyPushedRevocationList(listJWT string) {
+	applied, err := s.applyRevocationList(listJWT)
+	if err != nil {
+		slog.Error("Rejected revocation list from license server", "error", err)
+		return
+	}
+	if !applied {
+		return
+	}
+
+	s.cacheRevocationList(listJWT)
+	s.triggerValidation()
+}
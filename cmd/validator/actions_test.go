@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/enterprisesight/es-license-validator/pkg/config"
+	"github.com/enterprisesight/es-license-validator/pkg/license"
+	"github.com/enterprisesight/es-license-validator/pkg/phonehome"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestPushedRevocationListSurvivesRestart(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %v", err)
+	}
+	publicKeys := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	sign := func(claims jwt.MapClaims) string {
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(key)
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return signed
+	}
+
+	cfg := &config.Config{RevocationCachePath: filepath.Join(t.TempDir(), "revocations.jwt")}
+	newService := func() *ValidatorService {
+		validator, err := license.NewValidator(publicKeys)
+		if err != nil {
+			t.Fatalf("failed to create validator: %v", err)
+		}
+		return &ValidatorService{cfg: cfg, validator: validator, revalidate: make(chan struct{}, 1)}
+	}
+	licenseJWT := sign(jwt.MapClaims{
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(24 * time.Hour).Unix(),
+		"license_id":     "lic-1",
+		"namespace":      "es-core",
+		"product_code":   "es-core-gw",
+		"licensed_nodes": 3,
+	})
+	revoked := func(svc *ValidatorService) bool {
+		return svc.validator.Validate(licenseJWT, func(map[string]string) (license.Capacity, error) {
+			return license.Capacity{Nodes: 1}, nil
+		}, "es-core").Revoked
+	}
+
+	svc := newService()
+	svc.handlePhoneHomeResponse(phonehome.PhoneHomeRequest{LicenseID: "lic-1"}, &phonehome.PhoneHomeResponse{
+		Status: "ok",
+		RevocationList: sign(jwt.MapClaims{
+			"iat":         time.Now().Unix(),
+			"revocations": []interface{}{map[string]interface{}{"license_id": "lic-1", "reason": "contract terminated"}},
+		}),
+	})
+	if !revoked(svc) {
+		t.Fatal("license not revoked by the pushed revocation list")
+	}
+
+	// An unsigned or untrusted list is rejected
+	rejected := newService()
+	rejected.handlePhoneHomeResponse(phonehome.PhoneHomeRequest{LicenseID: "lic-1"}, &phonehome.PhoneHomeResponse{
+		Status:         "ok",
+		RevocationList: `{"revocations": [{"license_id": "lic-1"}]}`,
+	})
+	if revoked(rejected) {
+		t.Error("license revoked by an unsigned revocation list")
+	}
+
+	// After a restart the cached list still revokes the license
+	restarted := newService()
+	if !restarted.loadRevocationFiles() {
+		t.Fatal("cached revocation list not loaded")
+	}
+	if !revoked(restarted) {
+		t.Error("license not revoked after a restart")
+	}
+}
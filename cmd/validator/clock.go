@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// clockCheckLoop cross-checks the local clock against the API server's Date
+// header every CLOCK_CHECK_INTERVAL
+func (s *ValidatorService) clockCheckLoop(ctx context.Context, apiServerURL string, client *http.Client) {
+	ticker := time.NewTicker(s.cfg.ClockCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		reference, err := serverTime(ctx, client, apiServerURL+"/version")
+		if err != nil {
+			slog.Warn("Failed to read API server time", "error", err)
+		} else {
+			s.clock.Observe("apiserver", reference)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// serverTime returns the time from the Date header of a GET to url, taken
+// halfway through the request to offset the round trip
+func serverTime(ctx context.Context, client *http.Client, url string) (time.Time, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, "GET", url, nil)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	rtt := time.Since(start)
+
+	date := resp.Header.Get("Date")
+	if date == "" {
+		return time.Time{}, fmt.Errorf("response has no Date header")
+	}
+	reference, err := http.ParseTime(date)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid Date header %q: %w", date, err)
+	}
+	return reference.Add(rtt / 2), nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/enterprisesight/es-license-validator/pkg/config"
+	"github.com/enterprisesight/es-license-validator/pkg/phonehome"
+)
+
+// exportReport implements the export-report subcommand, which verifies the
+// offline usage report and writes it as a bundle for manual upload to the
+// license server. Returns the process exit code.
+func exportReport(args []string) int {
+	defaultPath := os.Getenv("OFFLINE_REPORT_PATH")
+	if defaultPath == "" {
+		defaultPath = config.DefaultOfflineReportPath
+	}
+
+	defaultKeyPath := os.Getenv("OFFLINE_REPORT_KEY_PATH")
+	if defaultKeyPath == "" {
+		defaultKeyPath = config.DefaultOfflineReportKeyPath
+	}
+
+	flags := flag.NewFlagSet("export-report", flag.ContinueOnError)
+	reportPath := flags.String("report", defaultPath, "path of the offline usage report")
+	keyPath := flags.String("key", defaultKeyPath, "path of the report key")
+	outputPath := flags.String("output", "-", "file to write the bundle to, or - for stdout")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var out io.Writer = os.Stdout
+	if *outputPath != "-" {
+		f, err := os.Create(*outputPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create output file: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+
+	key, err := phonehome.ReadReportKey(*keyPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load report key: %v\n", err)
+		return 1
+	}
+
+	if err := phonehome.ExportBundle(*reportPath, key, out); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to export usage report: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/enterprisesight/es-license-validator/pkg/license"
+)
+
+// loadPublicKeys returns the trusted signing keys: the PUBLIC_KEY_PATH file
+// if set, else ES_PUBLIC_KEY, else the embedded default key
+func loadPublicKeys(path string) (string, error) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read public key file: %w", err)
+		}
+		return string(data), nil
+	}
+
+	if publicKey := os.Getenv("ES_PUBLIC_KEY"); publicKey != "" {
+		return publicKey, nil
+	}
+	slog.Warn("Using default public key")
+	return DefaultPublicKey, nil
+}
+
+// keyReloadLoop reloads the keyring whenever the public key file changes, so
+// a rotated ConfigMap takes effect without a restart
+func (s *ValidatorService) keyReloadLoop(ctx context.Context) {
+	path := s.cfg.PublicKeyPath
+	if path == "" {
+		return
+	}
+
+	last, err := os.ReadFile(path)
+	if err != nil {
+		slog.Error("Failed to read public key file", "path", path, "error", err)
+	}
+
+	ticker := time.NewTicker(s.cfg.PublicKeyReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			slog.Error("Failed to read public key file", "path", path, "error", err)
+			continue
+		}
+		if bytes.Equal(data, last) {
+			continue
+		}
+
+		keys, err := license.ParseKeys(data)
+		if err != nil {
+			// Keep trusting the current keys rather than locking out every license
+			slog.Error("Ignoring invalid public key file", "path", path, "error", err)
+			continue
+		}
+		last = data
+
+		s.validator.Keyring().Replace(keys)
+		slog.Info("Reloaded public keys", "path", path, "keys", len(keys))
+		s.triggerValidation()
+	}
+}
@@ -3,24 +3,45 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/enterprisesight/es-license-validator/pkg/clock"
 	"github.com/enterprisesight/es-license-validator/pkg/config"
+	"github.com/enterprisesight/es-license-validator/pkg/events"
+	"github.com/enterprisesight/es-license-validator/pkg/history"
 	"github.com/enterprisesight/es-license-validator/pkg/license"
+	"github.com/enterprisesight/es-license-validator/pkg/logging"
+	"github.com/enterprisesight/es-license-validator/pkg/metering"
+	"github.com/enterprisesight/es-license-validator/pkg/metrics"
 	"github.com/enterprisesight/es-license-validator/pkg/nodes"
 	"github.com/enterprisesight/es-license-validator/pkg/phonehome"
+	"github.com/enterprisesight/es-license-validator/pkg/policy"
+	"github.com/enterprisesight/es-license-validator/pkg/secrets"
+	"github.com/enterprisesight/es-license-validator/pkg/workloads"
 
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
 
+// phoneHomeCheckInterval is how often phone home schedules are checked
+const phoneHomeCheckInterval = time.Minute
+
+// licenseWarningHeader carries license warnings, such as upcoming expiry, on
+// successful /ready responses
+const licenseWarningHeader = "X-License-Warning"
+
 // PublicKey is the ES public key for JWT verification
 // This will be embedded in the container or mounted as a ConfigMap
 const DefaultPublicKey = `-----BEGIN PUBLIC KEY-----
@@ -28,60 +49,133 @@ MIICIjANBgkqhkiG9w0BAQEFAAOCAg8AMIICCgKCAgEA...
 -----END PUBLIC KEY-----`
 
 type ValidatorService struct {
-	cfg              *config.Config
-	validator        *license.Validator
-	nodeCounter      *nodes.Counter
-	phoneHomeClient  *phonehome.Client
-	currentResult    *license.ValidationResult
-	k8sClient        *kubernetes.Clientset
+	cfg             *config.Config
+	validator       *license.Validator
+	nodeCounter     *nodes.Counter
+	phoneHomeClient *phonehome.Client
+	metrics         *metrics.Recorder
+	secretWatcher   *secrets.Watcher
+	history         *history.History
+	events          *events.Reporter
+	k8sClient       *kubernetes.Clientset
+	clock           *clock.Checker
+	enforcement     *policy.Policy
+	meter           *metering.Meter // nil when usage metering is disabled
+	revalidate      chan struct{}
+
+	phoneHomeScheduler *phonehome.Scheduler
+	phoneHomeCheck     chan struct{}
+
+	// Guarded by mu: written by the validation loop, read by HTTP handlers
+	mu             sync.RWMutex
+	currentResults map[string]*license.ValidationResult // keyed by product code
+	secretVersion  string                               // Secret resourceVersion of currentResults
 }
 
 func main() {
-	log.Println("Starting ES License Validator...")
+	// Subcommands
+	if len(os.Args) > 1 && os.Args[1] == "export-report" {
+		os.Exit(exportReport(os.Args[2:]))
+	}
 
 	// Load configuration
 	cfg, err := config.LoadConfig()
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		fatal("Failed to load configuration", err)
 	}
 
-	// Load public key
-	publicKey := os.Getenv("ES_PUBLIC_KEY")
-	if publicKey == "" {
-		publicKey = DefaultPublicKey
-		log.Println("Using default public key")
+	// Configure structured logging; also routes the standard log package
+	slog.SetDefault(logging.New(os.Stdout, cfg.LogLevel, cfg.LogFormat))
+	slog.Info("Starting ES License Validator")
+
+	// Load trusted public keys
+	publicKeys, err := loadPublicKeys(cfg.PublicKeyPath)
+	if err != nil {
+		fatal("Failed to load public keys", err)
 	}
 
 	// Create validator
-	validator, err := license.NewValidator(publicKey)
+	validator, err := license.NewValidator(publicKeys)
 	if err != nil {
-		log.Fatalf("Failed to create validator: %v", err)
+		fatal("Failed to create validator", err)
 	}
+	validator.SetIssuer(cfg.LicenseIssuer)
+	validator.SetAudience(cfg.LicenseAudience)
+
+	// Check license times against trusted time rather than the node clock alone
+	trustedClock := clock.NewChecker(cfg.ClockMaxSkew)
+	validator.SetClock(trustedClock)
+	validator.SetLeeway(cfg.LicenseLeeway)
+	validator.SetDefaultGracePeriod(cfg.GracePeriodDays)
+
+	// Decide what each kind of validation failure means for readiness
+	enforcement, err := policy.Parse(cfg.EnforcementPolicy, cfg.FailOpen)
+	if err != nil {
+		fatal("Invalid enforcement policy", err)
+	}
+	slog.Info("Loaded enforcement policy", "fail_open", cfg.FailOpen, "policy", enforcement.String())
 
 	// Create node counter
-	nodeCounter, err := nodes.NewCounter(cfg.NodeLabelKey, cfg.NodeLabelValue)
+	nodeCounter, err := nodes.NewCounter(cfg.NodeLabelKey, cfg.NodeLabelValue, cfg.NodeWatchSelector)
 	if err != nil {
-		log.Fatalf("Failed to create node counter: %v", err)
+		fatal("Failed to create node counter", err)
 	}
+	nodeCounter.SetGPUResources(splitList(cfg.GPUResources))
 
 	// Create phone home client
+	// Always created: a license's phone_home claim can enable phone home even
+	// when PHONE_HOME_ENABLED is false
 	var phoneHomeClient *phonehome.Client
-	if cfg.PhoneHomeEnabled {
+	if cfg.OfflineMode {
+		reportKey, err := phonehome.ReadReportKey(cfg.OfflineReportKeyPath)
+		if err != nil {
+			fatal("Failed to load offline report key", err)
+		}
+		phoneHomeClient, err = phonehome.NewOfflineClient(cfg.OfflineReportPath, reportKey)
+		if err != nil {
+			fatal("Failed to create offline phone home client", err)
+		}
+		slog.Info("Offline mode: writing usage reports locally",
+			"report_path", cfg.OfflineReportPath, "report_key_id", phonehome.ReportKeyID(reportKey))
+	} else {
 		phoneHomeClient = phonehome.NewClient(
 			cfg.LicenseServerURL,
 			cfg.PhoneHomeTimeout,
 			cfg.PhoneHomeRetries,
 		)
+
+		// Queue undelivered reports for replay after outages
+		outbox, err := phonehome.OpenOutbox(cfg.OutboxPath, cfg.OutboxMaxEntries, cfg.OutboxMaxAttempts)
+		if err != nil {
+			fatal("Failed to open phone home outbox", err)
+		}
+		phoneHomeClient.EnableOutbox(outbox)
+	}
+
+	// Remember when each license last phoned home across restarts
+	phoneHomeScheduler, err := phonehome.OpenScheduler(cfg.PhoneHomeStatePath)
+	if err != nil {
+		fatal("Failed to open phone home state", err)
 	}
 
 	// Create Kubernetes client
 	k8sConfig, err := rest.InClusterConfig()
 	if err != nil {
-		log.Fatalf("Failed to create in-cluster config: %v", err)
+		fatal("Failed to create in-cluster config", err)
 	}
 	k8sClient, err := kubernetes.NewForConfig(k8sConfig)
 	if err != nil {
-		log.Fatalf("Failed to create kubernetes client: %v", err)
+		fatal("Failed to create kubernetes client", err)
+	}
+	apiServerHTTPClient, err := rest.HTTPClientFor(k8sConfig)
+	if err != nil {
+		fatal("Failed to create API server HTTP client", err)
+	}
+
+	// Watch the license Secret
+	secretWatcher, err := secrets.NewWatcher(k8sClient, cfg.LicenseSecretNamespace, cfg.LicenseSecretName)
+	if err != nil {
+		fatal("Failed to create license secret watch", err)
 	}
 
 	// Create service
@@ -90,7 +184,25 @@ func main() {
 		validator:       validator,
 		nodeCounter:     nodeCounter,
 		phoneHomeClient: phoneHomeClient,
+		metrics:         metrics.NewRecorder(),
+		history:         history.New(cfg.HistorySize),
+		secretWatcher:   secretWatcher,
 		k8sClient:       k8sClient,
+		clock:           trustedClock,
+		enforcement:     enforcement,
+		revalidate:      make(chan struct{}, 1),
+
+		phoneHomeScheduler: phoneHomeScheduler,
+		phoneHomeCheck:     make(chan struct{}, 1),
+	}
+
+	// Apply renewed licenses, revocations and check-in updates pushed by the license server
+	phoneHomeClient.SetResponseHandler(svc.handlePhoneHomeResponse)
+
+	// Report license state transitions as Kubernetes Events
+	if cfg.EventsEnabled {
+		svc.events = events.NewReporter(k8sClient, cfg.LicenseSecretNamespace, cfg.LicenseSecretName)
+		defer svc.events.Shutdown()
 	}
 
 	// Start HTTP server
@@ -98,47 +210,153 @@ func main() {
 	mux.HandleFunc("/health", svc.healthHandler)
 	mux.HandleFunc("/ready", svc.readyHandler)
 	mux.HandleFunc("/status", svc.statusHandler)
+	mux.HandleFunc("/status/history", svc.historyHandler)
+	mux.HandleFunc("/usage", svc.usageHandler)
 
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%d", cfg.HTTPPort),
 		Handler: mux,
 	}
 
+	// Metrics server
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", svc.metrics.Handler())
+
+	metricsServer := &http.Server{
+		Addr:    fmt.Sprintf(":%d", cfg.MetricsPort),
+		Handler: metricsMux,
+	}
+
+	// Placement webhook pinning ES product pods onto licensed nodes
+	var webhookServer *http.Server
+	if cfg.WebhookEnabled {
+		webhookServer, err = svc.newWebhookServer()
+		if err != nil {
+			fatal("Failed to create placement webhook", err)
+		}
+	}
+
 	// Start validation loop
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Revalidate when nodes are added, removed or relabeled
+	if err := nodeCounter.OnChange(svc.triggerValidation); err != nil {
+		fatal("Failed to watch nodes", err)
+	}
+	if err := nodeCounter.Start(ctx); err != nil {
+		fatal("Failed to start node watch", err)
+	}
+
+	// Audit where ES product pods run against the licensed nodes
+	if cfg.PlacementAuditEnabled {
+		auditor, err := workloads.NewAuditor(k8sClient, cfg.ProductLabel, nodeCounter)
+		if err != nil {
+			fatal("Failed to create placement auditor", err)
+		}
+		if err := auditor.OnChange(svc.triggerValidation); err != nil {
+			fatal("Failed to watch product pods", err)
+		}
+		if err := auditor.Start(ctx); err != nil {
+			fatal("Failed to start product pod watch", err)
+		}
+		validator.SetPlacementAudit(auditor.Audit)
+	}
+
+	// Revalidate when the license Secret is created, updated or deleted
+	if err := svc.secretWatcher.OnChange(svc.triggerValidation); err != nil {
+		fatal("Failed to watch license secret", err)
+	}
+	if err := svc.secretWatcher.Start(ctx); err != nil {
+		fatal("Failed to start license secret watch", err)
+	}
+
+	// Meter node-hours, persisted in a ConfigMap across restarts. Samples
+	// further apart than two validation intervals are not integrated.
+	if cfg.UsageConfigMap != "" {
+		store := metering.NewConfigMapStore(k8sClient, cfg.LicenseSecretNamespace, cfg.UsageConfigMap)
+		svc.meter = metering.NewMeter(store, 2*cfg.ValidationInterval, cfg.UsageRetentionDays)
+		if err := svc.meter.Load(ctx); err != nil {
+			fatal("Failed to load metered usage", err)
+		}
+		phoneHomeClient.SetUsageSource(svc.meter.Usage)
+	}
+
+	// Apply mounted or cached revocations before the first validation
+	svc.loadRevocationFiles()
+
 	go svc.validationLoop(ctx)
+	go svc.revocationLoop(ctx)
+	go svc.keyReloadLoop(ctx)
+	go svc.clockCheckLoop(ctx, k8sConfig.Host, apiServerHTTPClient)
+
+	go phoneHomeClient.RunOutbox(ctx)
+	go svc.phoneHomeLoop(ctx)
 
 	// Start server
 	go func() {
-		log.Printf("HTTP server listening on :%d", cfg.HTTPPort)
+		slog.Info("HTTP server listening", "port", cfg.HTTPPort)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("HTTP server error: %v", err)
+			fatal("HTTP server error", err)
+		}
+	}()
+
+	go func() {
+		slog.Info("Metrics server listening", "port", cfg.MetricsPort)
+		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal("Metrics server error", err)
 		}
 	}()
 
+	if webhookServer != nil {
+		go func() {
+			slog.Info("Placement webhook listening", "port", cfg.WebhookPort, "placement", cfg.WebhookPlacement)
+			if err := webhookServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+				fatal("Placement webhook server error", err)
+			}
+		}()
+	}
+
 	// Wait for interrupt signal
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	<-sigChan
 
-	log.Println("Shutting down...")
+	slog.Info("Shutting down")
 	cancel()
 
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer shutdownCancel()
 	if err := server.Shutdown(shutdownCtx); err != nil {
-		log.Printf("HTTP server shutdown error: %v", err)
+		slog.Error("HTTP server shutdown error", "error", err)
+	}
+	if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Metrics server shutdown error", "error", err)
+	}
+	if webhookServer != nil {
+		if err := webhookServer.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Placement webhook shutdown error", "error", err)
+		}
 	}
 
-	log.Println("Shutdown complete")
+	slog.Info("Shutdown complete")
+}
+
+// fatal logs an unrecoverable error and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
 
 func (s *ValidatorService) validationLoop(ctx context.Context) {
 	ticker := time.NewTicker(s.cfg.ValidationInterval)
 	defer ticker.Stop()
 
+	// Debounce timer for watch-triggered revalidation, stopped until triggered
+	debounce := time.NewTimer(s.cfg.RevalidationDebounce)
+	debounce.Stop()
+	defer debounce.Stop()
+
 	// Run immediately on startup
 	s.runValidation(ctx)
 
@@ -148,75 +366,339 @@ func (s *ValidatorService) validationLoop(ctx context.Context) {
 			return
 		case <-ticker.C:
 			s.runValidation(ctx)
+		case <-s.revalidate:
+			debounce.Reset(s.cfg.RevalidationDebounce)
+		case <-debounce.C:
+			slog.Info("Watched resources changed, revalidating")
+			s.runValidation(ctx)
 		}
 	}
 }
 
+// triggerValidation requests a debounced revalidation without blocking
+func (s *ValidatorService) triggerValidation() {
+	select {
+	case s.revalidate <- struct{}{}:
+	default:
+	}
+}
+
 func (s *ValidatorService) runValidation(ctx context.Context) {
-	log.Println("Running license validation...")
-
-	// Read license from secret
-	secret, err := s.k8sClient.CoreV1().Secrets(s.cfg.LicenseSecretNamespace).Get(
-		ctx,
-		s.cfg.LicenseSecretName,
-		metav1.GetOptions{},
-	)
+	slog.Info("Running license validation")
+
+	// Read licenses from the watched secret
+	secret, err := s.secretWatcher.Get()
 	if err != nil {
-		log.Printf("ERROR: Failed to read license secret: %v", err)
-		s.currentResult = &license.ValidationResult{
-			Valid:          false,
-			Error:          fmt.Errorf("failed to read license secret: %w", err),
-			ValidationTime: time.Now(),
-		}
+		slog.Error("Failed to read license secret",
+			"secret", s.cfg.LicenseSecretName, "namespace", s.cfg.LicenseSecretNamespace, "error", err)
+		// A deleted Secret leaves no license, which always blocks; only other
+		// read errors are left to the secret_unreadable policy
+		s.storeResults(ctx, map[string]*license.ValidationResult{
+			s.cfg.LicenseSecretKey: {
+				Valid:            false,
+				Error:            fmt.Errorf("failed to read license secret: %w", err),
+				SecretUnreadable: !apierrors.IsNotFound(err),
+				ValidationTime:   time.Now(),
+			},
+		}, nil)
 		return
 	}
 
-	licenseJWT, ok := secret.Data[s.cfg.LicenseSecretKey]
-	if !ok {
-		log.Printf("ERROR: License key '%s' not found in secret", s.cfg.LicenseSecretKey)
-		s.currentResult = &license.ValidationResult{
-			Valid:          false,
-			Error:          fmt.Errorf("license key not found in secret"),
-			ValidationTime: time.Now(),
-		}
+	keys := licenseKeys(secret.Data, s.cfg.LicenseSecretKey)
+	slog.Debug("Read license secret",
+		"secret", secret.Name, "namespace", secret.Namespace,
+		"resource_version", secret.ResourceVersion, "license_keys", keys)
+	if len(keys) == 0 {
+		slog.Error("No license keys found in secret", "expected_key", s.cfg.LicenseSecretKey, "expected_pattern", "*.jwt")
+		s.storeResults(ctx, map[string]*license.ValidationResult{
+			s.cfg.LicenseSecretKey: {
+				Valid:          false,
+				Error:          fmt.Errorf("license key not found in secret"),
+				ValidationTime: time.Now(),
+			},
+		}, secret)
 		return
 	}
 
-	// Count labeled nodes
-	nodeCount, err := s.nodeCounter.CountLabeledNodes(ctx)
-	if err != nil {
-		log.Printf("ERROR: Failed to count nodes: %v", err)
-		nodeCount = 0
+	// Measure nodes using each license's node selector (env label as fallback)
+	measureNodes := func(selector map[string]string) (license.Capacity, error) {
+		capacity, err := s.nodeCounter.Measure(ctx, selector)
+		if err != nil {
+			// The enforcement policy decides whether this blocks (api_unreachable)
+			slog.Error("Failed to count nodes", "node_selector", selector, "error", err)
+			return license.Capacity{}, err
+		}
+		slog.Debug("Counted nodes", "node_selector", selector, "node_count", capacity.Nodes,
+			"vcpus", capacity.VCPUs, "memory_gib", capacity.MemoryGiB, "gpus", capacity.GPUs)
+		return capacity, nil
+	}
+
+	// Validate each license independently (including namespace binding check)
+	results := make(map[string]*license.ValidationResult, len(keys))
+	for _, key := range keys {
+		result := s.validator.Validate(string(secret.Data[key]), measureNodes, s.cfg.LicenseSecretNamespace)
+		product := productKey(key, result)
+		if _, exists := results[product]; exists {
+			slog.Warn("Duplicate license for product, ignoring", "product", product, "secret_key", key)
+			continue
+		}
+		results[product] = result
+
+		// Log result
+		attrs := resultAttrs(product, result)
+		if result.Valid && result.ExpiringSoon {
+			slog.Warn("License is expiring soon", attrs...)
+		} else if result.Valid {
+			slog.Info("License is valid", attrs...)
+		} else if result.IsInGracePeriod {
+			slog.Warn("License expired but in grace period", attrs...)
+		} else {
+			slog.Error("License is invalid", attrs...)
+		}
+		for _, productResult := range result.Products {
+			if productResult.Placement != nil && len(productResult.Placement.UnlicensedNodes) > 0 {
+				slog.Warn("Product pods are running on unlicensed nodes",
+					"product", productResult.ProductCode,
+					"unlicensed_nodes", productResult.Placement.UnlicensedNodes,
+					"unlicensed_pods", productResult.Placement.UnlicensedPods)
+			}
+		}
 	}
 
-	// Validate license (including namespace binding check)
-	result := s.validator.Validate(string(licenseJWT), nodeCount, s.cfg.LicenseSecretNamespace)
-	s.currentResult = result
+	if s.meter != nil {
+		s.recordUsage(ctx, results)
+	}
+	s.storeResults(ctx, results, secret)
+}
 
-	// Log result
-	if result.Valid {
-		log.Printf("✓ License is VALID - Nodes: %d/%d, Expires in %d days",
-			result.NodeCount, result.LicensedNodes, result.DaysUntilExpiry)
-	} else if result.IsInGracePeriod {
-		log.Printf("⚠ License EXPIRED but in GRACE PERIOD - Nodes: %d/%d",
-			result.NodeCount, result.LicensedNodes)
+// phoneHomeLoop phones home for each license when its schedule is due,
+// independently of the validation interval
+func (s *ValidatorService) phoneHomeLoop(ctx context.Context) {
+	ticker := time.NewTicker(phoneHomeCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.phoneHomeCheck:
+		}
+		s.phoneHomeDue()
+	}
+}
+
+// phoneHomeDue starts a phone home for every license whose schedule is due
+func (s *ValidatorService) phoneHomeDue() {
+	results, _ := s.snapshot()
+	now := time.Now()
+
+	products := make([]string, 0, len(results))
+	for product, result := range results {
+		if result.License == nil {
+			continue
+		}
+		products = append(products, product)
+
+		schedule := phonehome.ResolveSchedule(result.License,
+			s.cfg.PhoneHomeEnabled, s.cfg.LicenseServerURL, s.cfg.PhoneHomeInterval)
+		schedule = s.phoneHomeScheduler.ApplyCheckIn(result.License.LicenseID, schedule)
+		if s.cfg.OfflineMode {
+			// Reports are only recorded locally, so they are written even
+			// where phone home is disabled
+			schedule.Enabled = true
+		}
+		if s.phoneHomeScheduler.Due(product, schedule, now) {
+			go s.sendPhoneHome(product, schedule.ServerURL, result)
+		}
+	}
+	s.phoneHomeScheduler.Retain(products)
+}
+
+// sendPhoneHome reports a validation result to the license server (fail-open)
+func (s *ValidatorService) sendPhoneHome(product, serverURL string, result *license.ValidationResult) {
+	phoneCtx, cancel := context.WithTimeout(context.Background(), s.cfg.PhoneHomeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := s.phoneHomeClient.SendPhoneHomeTo(phoneCtx, serverURL, result)
+	if errors.Is(err, phonehome.ErrQueued) {
+		slog.Info("Phone home queued behind undelivered reports",
+			"product", product, "license_id", result.License.LicenseID)
+		return
+	}
+	s.metrics.ObservePhoneHome(result.License, time.Since(start), err)
+	if err != nil {
+		slog.Warn("Phone home failed (fail-open)",
+			"product", product, "license_id", result.License.LicenseID, "error", err)
 	} else {
-		log.Printf("✗ License is INVALID - %v", result.Error)
+		slog.Info("Phone home successful",
+			"product", product, "license_id", result.License.LicenseID)
+	}
+}
+
+// storeResults publishes a completed validation run to the HTTP handlers,
+// the history, the metrics and the Kubernetes events. secret is the license
+// Secret the results came from, or nil if it could not be read. The results
+// map must not be modified afterwards.
+func (s *ValidatorService) storeResults(ctx context.Context, results map[string]*license.ValidationResult, secret *corev1.Secret) {
+	secretVersion := ""
+	if secret != nil {
+		secretVersion = secret.ResourceVersion
 	}
 
-	// Phone home if enabled
-	if s.cfg.PhoneHomeEnabled && s.phoneHomeClient != nil && result.License != nil {
-		go func() {
-			phoneCtx, cancel := context.WithTimeout(context.Background(), s.cfg.PhoneHomeTimeout)
-			defer cancel()
+	s.mu.Lock()
+	s.currentResults = results
+	s.secretVersion = secretVersion
+	s.mu.Unlock()
+
+	products := make([]string, 0, len(results))
+	for product := range results {
+		products = append(products, product)
+	}
+	sort.Strings(products)
+
+	observed := make([]*license.ValidationResult, 0, len(results))
+	for _, product := range products {
+		s.history.Add(history.Entry{
+			Time:    results[product].ValidationTime,
+			Product: product,
+			State:   historyState(results[product], s.decide(results[product], "")),
+			Result:  results[product],
+		})
+		observed = append(observed, results[product])
+	}
+	s.metrics.ObserveResults(observed)
+
+	if s.events != nil {
+		s.events.Report(ctx, secret, results)
+	}
+
+	// Let the phone home scheduler pick up new or changed licenses
+	select {
+	case s.phoneHomeCheck <- struct{}{}:
+	default:
+	}
+}
+
+// snapshot returns the current results and the Secret version they came from
+func (s *ValidatorService) snapshot() (map[string]*license.ValidationResult, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.currentResults, s.secretVersion
+}
+
+// resultAttrs returns the structured log fields for a validation result
+func resultAttrs(product string, result *license.ValidationResult) []any {
+	attrs := []any{
+		"product", product,
+		"validation_status", phonehome.ValidationStatus(result),
+		"node_count", result.NodeCount,
+		"licensed_nodes", result.LicensedNodes,
+		"days_until_expiry", result.DaysUntilExpiry,
+	}
+	if result.UnlicensedNodes > 0 {
+		attrs = append(attrs, "unlicensed_nodes", result.UnlicensedNodes)
+	}
+	if result.License != nil {
+		attrs = append(attrs, "license_id", result.License.LicenseID)
+	}
+	if result.Error != nil {
+		attrs = append(attrs, "error", result.Error.Error())
+	}
+	return attrs
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// nonNil renders a nil slice as an empty JSON array
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// licenseKeys returns the Secret keys holding license JWTs in a stable order:
+// the configured key plus every key ending in ".jwt"
+func licenseKeys(data map[string][]byte, configuredKey string) []string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		if key == configuredKey || strings.HasSuffix(key, ".jwt") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// productKey identifies a result by the license's product code, falling back
+// to the license ID for multi-product licenses and to the Secret key when the
+// license could not be parsed
+func productKey(secretKey string, result *license.ValidationResult) string {
+	if result.License == nil {
+		return secretKey
+	}
+	if result.License.ProductCode != "" {
+		return result.License.ProductCode
+	}
+	if result.License.LicenseID != "" {
+		return result.License.LicenseID
+	}
+	return secretKey
+}
+
+// findProduct looks up a product either by result key or among the products
+// of a multi-product license
+func findProduct(results map[string]*license.ValidationResult, product string) (*license.ValidationResult, bool) {
+	if result, ok := results[product]; ok {
+		return result, true
+	}
+	for _, result := range results {
+		if _, ok := result.Product(product); ok {
+			return result, true
+		}
+	}
+	return nil, false
+}
 
-			if err := s.phoneHomeClient.SendPhoneHome(phoneCtx, result); err != nil {
-				log.Printf("Phone home failed (fail-open): %v", err)
-			} else {
-				log.Println("Phone home successful")
+// decide applies the enforcement policy to a result, or to a single product
+// of it when product is set
+func (s *ValidatorService) decide(result *license.ValidationResult, product string) policy.Decision {
+	if product != "" {
+		return s.enforcement.EvaluateProduct(result, product)
+	}
+	return s.enforcement.Evaluate(result)
+}
+
+// readiness sorts a product into not ready, with the blocking reasons, or
+// ready, with any warnings to report
+func readiness(product string, result *license.ValidationResult, decision policy.Decision) (reasons, warnings []string) {
+	if !decision.Allowed() {
+		for _, v := range decision.Violations {
+			if v.Action == policy.Block {
+				reasons = append(reasons, product+": "+v.Message)
 			}
-		}()
+		}
+		return reasons, nil
 	}
+
+	for _, warning := range decision.Warnings() {
+		warnings = append(warnings, product+": "+warning)
+	}
+	if result.ExpiringSoon {
+		warnings = append(warnings, product+": "+phonehome.ValidationMessage(result))
+	}
+	return nil, warnings
 }
 
 func (s *ValidatorService) healthHandler(w http.ResponseWriter, r *http.Request) {
@@ -230,7 +712,8 @@ func (s *ValidatorService) healthHandler(w http.ResponseWriter, r *http.Request)
 func (s *ValidatorService) readyHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	if s.currentResult == nil {
+	results, _ := s.snapshot()
+	if results == nil {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		json.NewEncoder(w).Encode(map[string]string{
 			"status":  "not_ready",
@@ -239,16 +722,61 @@ func (s *ValidatorService) readyHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if s.currentResult.Valid || (s.cfg.FailOpen && s.currentResult.IsInGracePeriod) {
-		json.NewEncoder(w).Encode(map[string]string{
+	notReady := make([]string, 0)
+	reasons := make([]string, 0)
+	warnings := make([]string, 0)
+
+	// Gate on a single product when requested
+	if product := r.URL.Query().Get("product"); product != "" {
+		result, ok := findProduct(results, product)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{
+				"status":  "not_ready",
+				"message": fmt.Sprintf("No license found for product %s", product),
+			})
+			return
+		}
+		blocked, warned := readiness(product, result, s.decide(result, product))
+		if len(blocked) > 0 {
+			notReady = append(notReady, product)
+		}
+		reasons = append(reasons, blocked...)
+		warnings = append(warnings, warned...)
+	} else {
+		for product, result := range results {
+			blocked, warned := readiness(product, result, s.decide(result, ""))
+			if len(blocked) > 0 {
+				notReady = append(notReady, product)
+			}
+			reasons = append(reasons, blocked...)
+			warnings = append(warnings, warned...)
+		}
+		sort.Strings(notReady)
+		sort.Strings(reasons)
+		sort.Strings(warnings)
+	}
+
+	if len(notReady) == 0 {
+		// Still ready, but let callers such as init containers log the warning
+		for _, warning := range warnings {
+			w.Header().Add(licenseWarningHeader, warning)
+		}
+		response := map[string]interface{}{
 			"status": "ready",
-		})
+		}
+		if len(warnings) > 0 {
+			response["warnings"] = warnings
+		}
+		json.NewEncoder(w).Encode(response)
 	} else {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status":  "not_ready",
-			"message": "License validation failed",
-			"valid":   s.currentResult.Valid,
+			"status":   "not_ready",
+			"message":  "License validation failed",
+			"valid":    false,
+			"products": notReady,
+			"reasons":  reasons,
 		})
 	}
 }
@@ -256,7 +784,8 @@ func (s *ValidatorService) readyHandler(w http.ResponseWriter, r *http.Request)
 func (s *ValidatorService) statusHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	if s.currentResult == nil {
+	results, secretVersion := s.snapshot()
+	if results == nil {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		json.NewEncoder(w).Encode(map[string]string{
 			"status":  "no_validation_result",
@@ -265,41 +794,253 @@ func (s *ValidatorService) statusHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	valid := true
+	allowed := true
+	products := make(map[string]interface{}, len(results))
+	for product, result := range results {
+		decision := s.decide(result, "")
+		valid = valid && result.Valid
+		allowed = allowed && decision.Allowed()
+
+		status := resultStatus(result)
+		status["enforcement"] = enforcementStatus(decision)
+		products[product] = status
+	}
+
 	response := map[string]interface{}{
-		"valid":              s.currentResult.Valid,
-		"validation_time":    s.currentResult.ValidationTime.Format(time.RFC3339),
-		"node_count":         s.currentResult.NodeCount,
-		"licensed_nodes":     s.currentResult.LicensedNodes,
-		"days_until_expiry":  s.currentResult.DaysUntilExpiry,
-		"in_grace_period":    s.currentResult.IsInGracePeriod,
-		"signature_valid":    s.currentResult.SignatureValid,
-		"expiry_valid":       s.currentResult.ExpiryValid,
-		"node_count_valid":   s.currentResult.NodeCountValid,
-		"namespace_valid":    s.currentResult.NamespaceValid,
-		"actual_namespace":   s.currentResult.ActualNamespace,
-		"license_namespace":  s.currentResult.LicenseNamespace,
-	}
-
-	if s.currentResult.License != nil {
-		response["license"] = map[string]interface{}{
-			"license_id":    s.currentResult.License.LicenseID,
-			"customer_name": s.currentResult.License.CustomerName,
-			"product_code":  s.currentResult.License.ProductCode,
-			"product_name":  s.currentResult.License.ProductName,
-			"tier_code":     s.currentResult.License.TierCode,
-			"cluster_id":    s.currentResult.License.ClusterID,
-			"namespace":     s.currentResult.License.Namespace,
-			"expires_at":    s.currentResult.License.ExpiresAt.Format(time.RFC3339),
+		"valid":                   valid,
+		"allowed":                 allowed,
+		"secret_resource_version": secretVersion,
+		"products":                products,
+		"enforcement_policy":      s.enforcement.Actions(),
+	}
+
+	phoneHome := make(map[string]interface{})
+	for product, st := range s.phoneHomeScheduler.Status() {
+		entry := map[string]interface{}{
+			"enabled":    st.Enabled,
+			"server_url": st.ServerURL,
+			"interval":   st.Interval.String(),
+			"source":     st.Source,
+		}
+		if !st.LastAt.IsZero() {
+			entry["last_at"] = st.LastAt.Format(time.RFC3339)
+		}
+		if !st.NextAt.IsZero() {
+			entry["next_at"] = st.NextAt.Format(time.RFC3339)
 		}
+		phoneHome[product] = entry
 	}
+	response["phone_home"] = phoneHome
 
-	if s.currentResult.Error != nil {
-		response["error"] = s.currentResult.Error.Error()
+	clockStatus := s.clock.Status()
+	clockInfo := map[string]interface{}{
+		"source":            clockStatus.Source,
+		"offset_seconds":    clockStatus.Offset.Seconds(),
+		"skewed":            clockStatus.Skewed,
+		"rollback_detected": clockStatus.RollbackDetected,
 	}
+	if !clockStatus.ObservedAt.IsZero() {
+		clockInfo["observed_at"] = clockStatus.ObservedAt.Format(time.RFC3339)
+	}
+	if clockStatus.RollbackDetected {
+		clockInfo["rollback_at"] = clockStatus.RollbackAt.Format(time.RFC3339)
+		clockInfo["rollback_seconds"] = clockStatus.Rollback.Seconds()
+	}
+	response["clock"] = clockInfo
 
-	if !s.currentResult.Valid {
-		w.WriteHeader(http.StatusOK) // Still return 200 for status endpoint
+	signingKeys := make([]map[string]interface{}, 0)
+	now := time.Now()
+	for _, key := range s.validator.Keyring().Keys() {
+		entry := map[string]interface{}{
+			"kid":        key.ID,
+			"type":       key.Type(),
+			"algorithms": key.Algorithms,
+			"active":     key.ActiveAt(now),
+		}
+		if !key.NotBefore.IsZero() {
+			entry["not_before"] = key.NotBefore.Format(time.RFC3339)
+		}
+		if !key.NotAfter.IsZero() {
+			entry["not_after"] = key.NotAfter.Format(time.RFC3339)
+		}
+		signingKeys = append(signingKeys, entry)
 	}
+	response["signing_keys"] = signingKeys
 
+	if list := s.validator.RevocationList(); list != nil {
+		response["revocation_list"] = map[string]interface{}{
+			"issued_at":   list.IssuedAt.Format(time.RFC3339),
+			"revocations": len(list.Revocations),
+		}
+	}
+
+	if s.phoneHomeClient != nil {
+		if stats, ok := s.phoneHomeClient.OutboxStats(); ok {
+			outbox := map[string]interface{}{
+				"depth":         stats.Depth,
+				"dead_lettered": stats.DeadLettered,
+			}
+			if stats.Depth > 0 {
+				outbox["oldest_enqueued_at"] = stats.OldestEnqueuedAt.Format(time.RFC3339)
+				outbox["oldest_entry_age_seconds"] = int(time.Since(stats.OldestEnqueuedAt).Seconds())
+			}
+			response["phone_home_outbox"] = outbox
+		}
+	}
+
+	// Still return 200 for status endpoint, even when invalid
 	json.NewEncoder(w).Encode(response)
 }
+
+// historyState identifies a result's validity, enforcement decision and
+// reason, so the history only records changes
+func historyState(result *license.ValidationResult, decision policy.Decision) string {
+	reason := ""
+	if result.Error != nil {
+		reason = result.Error.Error()
+	}
+	return fmt.Sprintf("valid=%t status=%s action=%s reason=%s",
+		result.Valid, phonehome.ValidationStatus(result), decision.Action, reason)
+}
+
+func (s *ValidatorService) historyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	product := r.URL.Query().Get("product")
+
+	entries := make([]map[string]interface{}, 0)
+	for _, entry := range s.history.Entries() {
+		if product != "" && entry.Product != product {
+			continue
+		}
+		status := resultStatus(entry.Result)
+		status["product"] = entry.Product
+		status["recorded_at"] = entry.Time.Format(time.RFC3339)
+		status["first_seen_at"] = entry.FirstSeen.Format(time.RFC3339)
+		status["count"] = entry.Count
+		entries = append(entries, status)
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries": entries,
+	})
+}
+
+// enforcementStatus renders an enforcement decision for the status endpoint
+func enforcementStatus(decision policy.Decision) map[string]interface{} {
+	violations := make([]map[string]string, 0, len(decision.Violations))
+	for _, v := range decision.Violations {
+		violations = append(violations, map[string]string{
+			"mode":    string(v.Mode),
+			"action":  string(v.Action),
+			"message": v.Message,
+		})
+	}
+	return map[string]interface{}{
+		"action":     decision.Action,
+		"allowed":    decision.Allowed(),
+		"violations": violations,
+	}
+}
+
+// resultStatus renders a single validation result for the status endpoint
+func resultStatus(result *license.ValidationResult) map[string]interface{} {
+	response := map[string]interface{}{
+		"valid":             result.Valid,
+		"validation_time":   result.ValidationTime.Format(time.RFC3339),
+		"node_count":        result.NodeCount,
+		"licensed_nodes":    result.LicensedNodes,
+		"max_nodes":         result.MaxNodes,
+		"overage":           result.Overage,
+		"overage_nodes":     result.OverageNodes,
+		"days_until_expiry": result.DaysUntilExpiry,
+		"in_grace_period":   result.IsInGracePeriod,
+		"expiring_soon":     result.ExpiringSoon,
+		"signature_valid":   result.SignatureValid,
+		"key_id":            result.KeyID,
+		"algorithm":         result.Algorithm,
+		"expiry_valid":      result.ExpiryValid,
+		"not_before_valid":  result.NotBeforeValid,
+		"node_count_valid":  result.NodeCountValid,
+		"capacity_valid":    result.CapacityValid,
+		"namespace_valid":   result.NamespaceValid,
+		"actual_namespace":  result.ActualNamespace,
+		"license_namespace": result.LicenseNamespace,
+		"unlicensed_nodes":  result.UnlicensedNodes,
+	}
+
+	if result.Revoked {
+		response["revoked"] = true
+		response["revocation_reason"] = result.RevocationReason
+	}
+
+	if result.License != nil {
+		response["license"] = map[string]interface{}{
+			"license_id":    result.License.LicenseID,
+			"customer_name": result.License.CustomerName,
+			"product_code":  result.License.ProductCode,
+			"product_name":  result.License.ProductName,
+			"tier_code":     result.License.TierCode,
+			"cluster_id":    result.License.ClusterID,
+			"namespace":     result.License.Namespace,
+			"node_selector": result.License.NodeSelector,
+			"expires_at":    result.License.ExpiresAt.Format(time.RFC3339),
+		}
+	}
+
+	if len(result.Products) > 0 {
+		products := make([]map[string]interface{}, 0, len(result.Products))
+		for _, product := range result.Products {
+			entry := map[string]interface{}{
+				"product_code":     product.ProductCode,
+				"product_name":     product.ProductName,
+				"tier_code":        product.TierCode,
+				"node_selector":    product.NodeSelector,
+				"node_count":       product.NodeCount,
+				"licensed_nodes":   product.LicensedNodes,
+				"max_nodes":        product.MaxNodes,
+				"node_count_valid": product.NodeCountValid,
+				"overage":          product.Overage,
+				"overage_nodes":    product.OverageNodes,
+				"capacity_valid":   product.CapacityValid,
+				"valid":            product.Valid,
+			}
+			if len(product.Dimensions) > 0 {
+				entry["capacity"] = map[string]interface{}{
+					"nodes":      product.Capacity.Nodes,
+					"vcpus":      product.Capacity.VCPUs,
+					"memory_gib": product.Capacity.MemoryGiB,
+					"gpus":       product.Capacity.GPUs,
+				}
+				dimensions := make([]map[string]interface{}, 0, len(product.Dimensions))
+				for _, dimension := range product.Dimensions {
+					dimensions = append(dimensions, map[string]interface{}{
+						"dimension": dimension.Dimension,
+						"used":      dimension.Used,
+						"licensed":  dimension.Licensed,
+						"max":       dimension.Max,
+						"valid":     dimension.Valid,
+						"overage":   dimension.Overage,
+					})
+				}
+				entry["dimensions"] = dimensions
+			}
+			if product.Placement != nil {
+				entry["placement"] = map[string]interface{}{
+					"pods":             product.Placement.Pods,
+					"unlicensed_pods":  nonNil(product.Placement.UnlicensedPods),
+					"unlicensed_nodes": nonNil(product.Placement.UnlicensedNodes),
+				}
+			}
+			products = append(products, entry)
+		}
+		response["products"] = products
+	}
+
+	if result.Error != nil {
+		response["error"] = result.Error.Error()
+	}
+
+	return response
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/enterprisesight/es-license-validator/pkg/config"
+	"github.com/enterprisesight/es-license-validator/pkg/history"
+	"github.com/enterprisesight/es-license-validator/pkg/metrics"
+	"github.com/enterprisesight/es-license-validator/pkg/policy"
+	"github.com/enterprisesight/es-license-validator/pkg/secrets"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestUnreadableSecretFollowsFailOpen(t *testing.T) {
+	tests := []struct {
+		name     string
+		failOpen bool
+		status   int
+	}{
+		{name: "fail-open warns", failOpen: true, status: http.StatusOK},
+		{name: "fail-closed blocks", failOpen: false, status: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The validator lacks RBAC permissions on the license Secret
+			clientset := fake.NewSimpleClientset()
+			denied := apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "es-license", nil)
+			clientset.PrependReactor("list", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, denied
+			})
+			clientset.PrependWatchReactor("secrets", func(k8stesting.Action) (bool, watch.Interface, error) {
+				return true, nil, denied
+			})
+
+			watcher, err := secrets.NewWatcher(clientset, "es-core", "es-license")
+			if err != nil {
+				t.Fatalf("NewWatcher: %v", err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := watcher.Start(ctx); err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+
+			svc := &ValidatorService{
+				cfg: &config.Config{
+					LicenseSecretName:      "es-license",
+					LicenseSecretNamespace: "es-core",
+					LicenseSecretKey:       "license.jwt",
+				},
+				secretWatcher:  watcher,
+				metrics:        metrics.NewRecorder(),
+				history:        history.New(10),
+				enforcement:    policy.Default(tt.failOpen),
+				phoneHomeCheck: make(chan struct{}, 1),
+			}
+			svc.runValidation(ctx)
+
+			results, _ := svc.snapshot()
+			if result := results["license.jwt"]; result == nil || !result.SecretUnreadable {
+				t.Fatalf("result = %+v, want the secret reported unreadable", result)
+			}
+
+			rec := httptest.NewRecorder()
+			svc.readyHandler(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+			if rec.Code != tt.status {
+				t.Errorf("/ready status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.failOpen && rec.Header().Get(licenseWarningHeader) == "" {
+				t.Error("/ready did not warn about the unreadable secret")
+			}
+		})
+	}
+}
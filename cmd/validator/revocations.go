@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// revocationLoop keeps the revocation list current: it fetches the list from
+// the license server and reloads the mounted file every refresh interval
+func (s *ValidatorService) revocationLoop(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.RevocationRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		changed := s.fetchRevocationList(ctx)
+		if s.loadRevocationFiles() {
+			changed = true
+		}
+		if changed {
+			s.triggerValidation()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// loadRevocationFiles applies the revocation lists from the mounted file and
+// from the cache of the last fetched list. Returns whether a newer list was
+// applied.
+func (s *ValidatorService) loadRevocationFiles() bool {
+	changed := false
+	for _, path := range []string{s.cfg.RevocationListPath, s.cfg.RevocationCachePath} {
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			slog.Error("Failed to read revocation list", "path", path, "error", err)
+			continue
+		}
+		applied, err := s.applyRevocationList(string(data))
+		if err != nil {
+			slog.Error("Rejected revocation list", "path", path, "error", err)
+			continue
+		}
+		if applied {
+			slog.Info("Loaded revocation list", "path", path)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// fetchRevocationList applies the revocation list from the license server
+// and caches it. Returns whether a newer list was applied.
+func (s *ValidatorService) fetchRevocationList(ctx context.Context) bool {
+	if s.cfg.OfflineMode || s.cfg.LicenseServerURL == "" {
+		return false
+	}
+
+	fetchCtx, cancel := context.WithTimeout(ctx, s.cfg.PhoneHomeTimeout)
+	defer cancel()
+
+	listJWT, err := s.phoneHomeClient.FetchRevocationList(fetchCtx, s.cfg.LicenseServerURL)
+	if err != nil {
+		slog.Warn("Failed to fetch revocation list (keeping current list)", "error", err)
+		return false
+	}
+	applied, err := s.applyRevocationList(listJWT)
+	if err != nil {
+		slog.Error("Rejected revocation list from license server", "error", err)
+		return false
+	}
+	if !applied {
+		return false
+	}
+
+	slog.Info("Fetched revocation list from license server")
+	s.cacheRevocationList(listJWT)
+	return true
+}
+
+// cacheRevocationList writes an applied revocation list to the cache, so it
+// survives restarts while the license server is unreachable
+func (s *ValidatorService) cacheRevocationList(listJWT string) {
+	if s.cfg.RevocationCachePath == "" {
+		return
+	}
+	if err := writeFileAtomic(s.cfg.RevocationCachePath, []byte(listJWT)); err != nil {
+		slog.Error("Failed to cache revocation list", "path", s.cfg.RevocationCachePath, "error", err)
+	}
+}
+
+// applyRevocationList verifies a revocation list JWT and applies it if it is
+// newer than the current list
+func (s *ValidatorService) applyRevocationList(listJWT string) (bool, error) {
+	list, err := s.validator.ParseRevocationList(strings.TrimSpace(listJWT))
+	if err != nil {
+		return false, err
+	}
+	applied, err := s.validator.SetRevocationList(list)
+	if err != nil {
+		return false, err
+	}
+	if applied {
+		slog.Info("Revocation list updated",
+			"issued_at", list.IssuedAt.Format(time.RFC3339), "revocations", len(list.Revocations))
+	}
+	return applied, nil
+}
+
+// writeFileAtomic replaces the file at path with data
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/enterprisesight/es-license-validator/pkg/license"
+	"github.com/enterprisesight/es-license-validator/pkg/metering"
+)
+
+// recordUsage meters the node count of every product with a known count
+func (s *ValidatorService) recordUsage(ctx context.Context, results map[string]*license.ValidationResult) {
+	nodeCounts := make(map[string]int)
+	for _, result := range results {
+		// Skip results whose node count is unknown rather than metering zero
+		if result.License == nil || result.NodeCountUnavailable {
+			continue
+		}
+		for _, product := range result.Products {
+			if product.ProductCode != "" {
+				nodeCounts[product.ProductCode] = product.NodeCount
+			}
+		}
+	}
+	if len(nodeCounts) == 0 {
+		return
+	}
+
+	if err := s.meter.Record(ctx, s.clock.Now(), nodeCounts); err != nil {
+		slog.Error("Failed to record usage", "error", err)
+	}
+}
+
+// usageHandler serves the metered usage: node-hours, and peak and average
+// node counts per day
+func (s *ValidatorService) usageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if s.meter == nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Usage metering is disabled",
+		})
+		return
+	}
+
+	var products []metering.ProductUsage
+	if product := r.URL.Query().Get("product"); product != "" {
+		usage, ok := s.meter.Usage(product)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": fmt.Sprintf("No usage recorded for product %s", product),
+			})
+			return
+		}
+		products = append(products, usage)
+	} else {
+		products = s.meter.All()
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"products": products,
+	})
+}
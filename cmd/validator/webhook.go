@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"github.com/enterprisesight/es-license-validator/pkg/webhook"
+)
+
+// newWebhookServer creates the HTTPS server for the placement webhook
+func (s *ValidatorService) newWebhookServer() (*http.Server, error) {
+	mutator, err := webhook.NewPlacementMutator(s.cfg.ProductLabel, s.cfg.WebhookPlacement, s.productNodeSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	certs, err := webhook.NewCertLoader(
+		filepath.Join(s.cfg.WebhookCertDir, "tls.crt"),
+		filepath.Join(s.cfg.WebhookCertDir, "tls.key"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/mutate/placement", mutator)
+
+	return &http.Server{
+		Addr:    fmt.Sprintf(":%d", s.cfg.WebhookPort),
+		Handler: mux,
+		TLSConfig: &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.GetCertificate,
+		},
+	}, nil
+}
+
+// productNodeSelector returns the nodes a product's pods must run on: the
+// product's node_selector from its license, else the license-wide one, else
+// NODE_LABEL_KEY=NODE_LABEL_VALUE. These are the nodes the license counts.
+func (s *ValidatorService) productNodeSelector(product string) map[string]string {
+	results, _ := s.snapshot()
+	if result, ok := findProduct(results, product); ok {
+		if productResult, ok := result.Product(product); ok && len(productResult.NodeSelector) > 0 {
+			return productResult.NodeSelector
+		}
+		if result.License != nil && len(result.License.NodeSelector) > 0 {
+			return result.License.NodeSelector
+		}
+	}
+	return map[string]string{s.cfg.NodeLabelKey: s.cfg.NodeLabelValue}
+}
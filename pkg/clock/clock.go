@@ -0,0 +1,116 @@
+package clock
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Checker is a clock that cross-checks local time against trusted reference
+// times, such as the API server's Date header or the license server's
+// response time. Once a reference has been observed, Now is corrected by the
+// measured offset. It also detects the wall clock being set back.
+type Checker struct {
+	maxSkew time.Duration
+	now     func() time.Time
+
+	mu         sync.Mutex
+	offset     time.Duration // reference minus local time
+	source     string        // source of the last reference, "" if none yet
+	observedAt time.Time     // local time of the last reference
+	last       time.Time     // last local reading, with its monotonic clock
+	rollbackAt time.Time     // local time a rollback was last detected
+	rollback   time.Duration // size of the last detected rollback
+}
+
+// Status describes the clock for the status endpoint
+type Status struct {
+	Source           string // "local" until a trusted reference is observed
+	Offset           time.Duration
+	ObservedAt       time.Time
+	Skewed           bool // local time differs from the reference by more than the max skew
+	RollbackDetected bool
+	RollbackAt       time.Time
+	Rollback         time.Duration
+}
+
+// NewChecker creates a clock that flags differences beyond maxSkew
+func NewChecker(maxSkew time.Duration) *Checker {
+	return &Checker{
+		maxSkew: maxSkew,
+		now:     time.Now,
+	}
+}
+
+// Now returns the local time corrected by the last trusted reference
+func (c *Checker) Now() time.Time {
+	local := c.now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checkRollback(local)
+	return local.Add(c.offset)
+}
+
+// Observe records a trusted reference time from the named source
+func (c *Checker) Observe(source string, reference time.Time) {
+	local := c.now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checkRollback(local)
+
+	offset := reference.Sub(local)
+	if abs(offset) > c.maxSkew {
+		slog.Warn("Local clock differs from trusted time",
+			"source", source, "offset", offset.Round(time.Second), "max_skew", c.maxSkew)
+	}
+	c.offset = offset
+	c.source = source
+	c.observedAt = local
+}
+
+// Status returns the current offset and any detected rollback
+func (c *Checker) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := Status{
+		Source:           "local",
+		Offset:           c.offset,
+		ObservedAt:       c.observedAt,
+		Skewed:           abs(c.offset) > c.maxSkew,
+		RollbackDetected: !c.rollbackAt.IsZero(),
+		RollbackAt:       c.rollbackAt,
+		Rollback:         c.rollback,
+	}
+	if c.source != "" {
+		status.Source = c.source
+	}
+	return status
+}
+
+// checkRollback compares the wall clock with the monotonic clock since the
+// last reading: the monotonic clock never goes back, so a wall clock that
+// fell behind it was set back. The offset absorbs the rollback so Now keeps
+// moving forward until the next reference. Callers must hold c.mu.
+func (c *Checker) checkRollback(local time.Time) {
+	if !c.last.IsZero() {
+		wall := local.Round(0).Sub(c.last.Round(0))
+		monotonic := local.Sub(c.last)
+		if drift := monotonic - wall; drift > c.maxSkew {
+			c.rollbackAt = local
+			c.rollback = drift
+			c.offset += drift
+			slog.Warn("System clock was set back", "rollback", drift.Round(time.Second))
+		}
+	}
+	c.last = local
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,64 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckerOffset(t *testing.T) {
+	local := time.Date(2025, 10, 21, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		reference time.Duration // reference minus local time
+		skewed    bool
+	}{
+		{name: "in sync", reference: 0},
+		{name: "within max skew", reference: 30 * time.Second},
+		{name: "local clock behind", reference: 2 * time.Hour, skewed: true},
+		{name: "local clock ahead", reference: -26 * time.Hour, skewed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewChecker(time.Minute)
+			c.now = func() time.Time { return local }
+
+			if status := c.Status(); status.Source != "local" || status.Offset != 0 {
+				t.Errorf("before any reference: status = %+v", status)
+			}
+
+			c.Observe("kube-apiserver", local.Add(tt.reference))
+			if got := c.Now(); !got.Equal(local.Add(tt.reference)) {
+				t.Errorf("Now = %s, want the reference time %s", got, local.Add(tt.reference))
+			}
+
+			status := c.Status()
+			if status.Source != "kube-apiserver" || status.Offset != tt.reference || !status.ObservedAt.Equal(local) {
+				t.Errorf("status = %+v, want offset %s from kube-apiserver", status, tt.reference)
+			}
+			if status.Skewed != tt.skewed {
+				t.Errorf("skewed = %v, want %v", status.Skewed, tt.skewed)
+			}
+			if status.RollbackDetected {
+				t.Error("rollback detected without one")
+			}
+		})
+	}
+}
+
+func TestCheckerFollowsLatestReference(t *testing.T) {
+	local := time.Date(2025, 10, 21, 12, 0, 0, 0, time.UTC)
+	c := NewChecker(time.Minute)
+	c.now = func() time.Time { return local }
+
+	c.Observe("kube-apiserver", local.Add(time.Hour))
+	c.Observe("license-server", local.Add(-time.Hour))
+
+	if got := c.Now(); !got.Equal(local.Add(-time.Hour)) {
+		t.Errorf("Now = %s, want the latest reference", got)
+	}
+	if status := c.Status(); status.Source != "license-server" {
+		t.Errorf("source = %s, want license-server", status.Source)
+	}
+}
@@ -7,6 +7,12 @@ import (
 	"time"
 )
 
+// DefaultOfflineReportPath is where the offline usage report is written by default
+const DefaultOfflineReportPath = "/var/lib/es-license-validator/usage-report.jsonl"
+
+// DefaultOfflineReportKeyPath is where the offline report key is mounted by default
+const DefaultOfflineReportKeyPath = "/etc/es-license-validator/report-key/report.key"
+
 // Config holds the application configuration
 type Config struct {
 	// License configuration
@@ -15,20 +21,63 @@ type Config struct {
 	LicenseSecretKey       string
 
 	// Node selector for licensed nodes
-	NodeLabelKey   string
-	NodeLabelValue string
+	NodeLabelKey      string
+	NodeLabelValue    string
+	NodeWatchSelector string // Label selector limiting which nodes are cached ("" caches all)
+	GPUResources      string // Comma-separated extended resources counted as GPUs
+
+	// Workload configuration
+	ProductLabel          string // Pod label naming the ES product of a pod
+	PlacementAuditEnabled bool   // Flag product pods running on nodes outside the licensed selector
 
 	// Phone home configuration
-	LicenseServerURL    string
-	PhoneHomeEnabled    bool
-	PhoneHomeInterval   time.Duration
-	PhoneHomeRetries    int
-	PhoneHomeTimeout    time.Duration
+	LicenseServerURL     string
+	PhoneHomeEnabled     bool
+	PhoneHomeInterval    time.Duration
+	PhoneHomeRetries     int
+	PhoneHomeTimeout     time.Duration
+	OfflineMode          bool   // Write phone home reports to OfflineReportPath instead of sending them
+	OfflineReportPath    string // Append-only, hash-chained usage report used in offline mode
+	OfflineReportKeyPath string // Per-installation key issued by the vendor authenticating the report
+	OutboxPath           string // Persistent queue of undelivered phone home reports ("" keeps it in memory)
+	OutboxMaxEntries     int    // Oldest queued reports are dropped beyond this
+	OutboxMaxAttempts    int    // Queued reports are given up on after this many replays (0 retries forever)
+	PhoneHomeStatePath   string // Last phone home time per license ("" keeps it in memory)
+
+	// Signing key configuration
+	LicenseIssuer           string        // Required iss claim ("" to skip the check)
+	LicenseAudience         string        // Audience that must appear in the aud claim ("" to skip the check)
+	PublicKeyPath           string        // PEM bundle or JWKS file of trusted keys, e.g. mounted from a ConfigMap
+	PublicKeyReloadInterval time.Duration // How often PublicKeyPath is checked for changes
+
+	// Revocation list configuration
+	RevocationListPath        string        // Signed revocation list mounted from a ConfigMap ("" to disable)
+	RevocationCachePath       string        // Last revocation list fetched from the license server
+	RevocationRefreshInterval time.Duration // How often the revocation list is reloaded and fetched
 
 	// Validation configuration
-	ValidationInterval  time.Duration
-	FailOpen            bool  // If true, allow operations when license is invalid (during grace period)
-	GracePeriodDays     int   // Grace period from license
+	ValidationInterval   time.Duration
+	FailOpen             bool          // Default enforcement: warn on infrastructure failures
+	EnforcementPolicy    string        // Per-failure overrides, e.g. "node_overage=warn,expiry=block"
+	RevalidationDebounce time.Duration // Delay before revalidating after a watched change
+	HistorySize          int           // Number of validation results kept for /status/history
+	EventsEnabled        bool          // Emit Kubernetes Events and a status annotation on the license Secret
+	GracePeriodDays      int           // Grace period for licenses without grace_period_days
+
+	// Usage metering configuration
+	UsageConfigMap     string // ConfigMap persisting metered node-hours ("" to disable)
+	UsageRetentionDays int    // Days of daily usage aggregates kept
+
+	// Time configuration
+	LicenseLeeway      time.Duration // Clock skew tolerated on the exp and nbf claims
+	ClockMaxSkew       time.Duration // Local clock offset from trusted time that is flagged
+	ClockCheckInterval time.Duration // How often local time is checked against the API server
+
+	// Placement webhook configuration
+	WebhookEnabled   bool   // Serve the mutating webhook pinning ES pods onto licensed nodes
+	WebhookPort      int    // HTTPS port of the webhook
+	WebhookCertDir   string // Directory holding tls.crt and tls.key
+	WebhookPlacement string // nodeSelector or affinity
 
 	// Server configuration
 	HTTPPort            int
@@ -36,8 +85,8 @@ type Config struct {
 	HealthCheckInterval time.Duration
 
 	// Logging
-	LogLevel            string
-	LogFormat           string // json or text
+	LogLevel  string
+	LogFormat string // json or text
 }
 
 // LoadConfig loads configuration from environment variables
@@ -50,15 +99,52 @@ func LoadConfig() (*Config, error) {
 
 		NodeLabelKey:   getEnv("NODE_LABEL_KEY", "es-products.io/licensed"),
 		NodeLabelValue: getEnv("NODE_LABEL_VALUE", "true"),
-
-		LicenseServerURL:    getEnv("LICENSE_SERVER_URL", ""),
-		PhoneHomeEnabled:    getEnvBool("PHONE_HOME_ENABLED", true),
-		PhoneHomeInterval:   getEnvDuration("PHONE_HOME_INTERVAL", 24*time.Hour),
-		PhoneHomeRetries:    getEnvInt("PHONE_HOME_RETRIES", 3),
-		PhoneHomeTimeout:    getEnvDuration("PHONE_HOME_TIMEOUT", 30*time.Second),
-
-		ValidationInterval:  getEnvDuration("VALIDATION_INTERVAL", 5*time.Minute),
-		FailOpen:            getEnvBool("FAIL_OPEN", true),
+		GPUResources:   getEnv("GPU_RESOURCES", "nvidia.com/gpu,amd.com/gpu"),
+
+		ProductLabel:          getEnv("PRODUCT_LABEL", "es-products.io/product"),
+		PlacementAuditEnabled: getEnvBool("PLACEMENT_AUDIT_ENABLED", true),
+
+		LicenseServerURL:     getEnv("LICENSE_SERVER_URL", ""),
+		PhoneHomeEnabled:     getEnvBool("PHONE_HOME_ENABLED", true),
+		PhoneHomeInterval:    getEnvDuration("PHONE_HOME_INTERVAL", 24*time.Hour),
+		PhoneHomeRetries:     getEnvInt("PHONE_HOME_RETRIES", 3),
+		PhoneHomeTimeout:     getEnvDuration("PHONE_HOME_TIMEOUT", 30*time.Second),
+		OfflineMode:          getEnvBool("OFFLINE_MODE", false),
+		OfflineReportPath:    getEnv("OFFLINE_REPORT_PATH", DefaultOfflineReportPath),
+		OfflineReportKeyPath: getEnv("OFFLINE_REPORT_KEY_PATH", DefaultOfflineReportKeyPath),
+		OutboxPath:           getEnvAllowEmpty("OUTBOX_PATH", "/var/lib/es-license-validator/outbox.json"),
+		OutboxMaxEntries:     getEnvInt("OUTBOX_MAX_ENTRIES", 10000),
+		OutboxMaxAttempts:    getEnvInt("OUTBOX_MAX_ATTEMPTS", 1000),
+		PhoneHomeStatePath:   getEnvAllowEmpty("PHONE_HOME_STATE_PATH", "/var/lib/es-license-validator/phone-home.json"),
+
+		LicenseIssuer:           getEnv("LICENSE_ISSUER", ""),
+		LicenseAudience:         getEnv("LICENSE_AUDIENCE", ""),
+		PublicKeyPath:           getEnv("PUBLIC_KEY_PATH", ""),
+		PublicKeyReloadInterval: getEnvDuration("PUBLIC_KEY_RELOAD_INTERVAL", 30*time.Second),
+
+		RevocationListPath:        getEnv("REVOCATION_LIST_PATH", ""),
+		RevocationCachePath:       getEnv("REVOCATION_CACHE_PATH", "/var/lib/es-license-validator/revocations.jwt"),
+		RevocationRefreshInterval: getEnvDuration("REVOCATION_REFRESH_INTERVAL", time.Hour),
+
+		ValidationInterval:   getEnvDuration("VALIDATION_INTERVAL", 5*time.Minute),
+		FailOpen:             getEnvBool("FAIL_OPEN", true),
+		EnforcementPolicy:    getEnv("ENFORCEMENT_POLICY", ""),
+		RevalidationDebounce: getEnvDuration("REVALIDATION_DEBOUNCE", 5*time.Second),
+		HistorySize:          getEnvInt("HISTORY_SIZE", 100),
+		EventsEnabled:        getEnvBool("EVENTS_ENABLED", true),
+		GracePeriodDays:      getEnvInt("GRACE_PERIOD_DAYS", 0),
+
+		UsageConfigMap:     getEnvAllowEmpty("USAGE_CONFIGMAP", "es-license-usage"),
+		UsageRetentionDays: getEnvInt("USAGE_RETENTION_DAYS", 90),
+
+		LicenseLeeway:      getEnvDuration("LICENSE_LEEWAY", 5*time.Minute),
+		ClockMaxSkew:       getEnvDuration("CLOCK_MAX_SKEW", 2*time.Minute),
+		ClockCheckInterval: getEnvDuration("CLOCK_CHECK_INTERVAL", 10*time.Minute),
+
+		WebhookEnabled:   getEnvBool("WEBHOOK_ENABLED", false),
+		WebhookPort:      getEnvInt("WEBHOOK_PORT", 8443),
+		WebhookCertDir:   getEnv("WEBHOOK_CERT_DIR", "/etc/es-license-validator/webhook"),
+		WebhookPlacement: getEnv("WEBHOOK_PLACEMENT", "nodeSelector"),
 
 		HTTPPort:            getEnvInt("HTTP_PORT", 8080),
 		MetricsPort:         getEnvInt("METRICS_PORT", 9090),
@@ -69,10 +155,13 @@ func LoadConfig() (*Config, error) {
 	}
 
 	// Validate required fields
-	if cfg.LicenseServerURL == "" && cfg.PhoneHomeEnabled {
-		return nil, fmt.Errorf("LICENSE_SERVER_URL is required when PHONE_HOME_ENABLED=true")
+	if cfg.LicenseServerURL == "" && cfg.PhoneHomeEnabled && !cfg.OfflineMode {
+		return nil, fmt.Errorf("LICENSE_SERVER_URL is required when PHONE_HOME_ENABLED=true and OFFLINE_MODE=false")
 	}
 
+	// Cache only nodes carrying the licensed label key unless set, even to ""
+	cfg.NodeWatchSelector = getEnvAllowEmpty("NODE_WATCH_SELECTOR", cfg.NodeLabelKey)
+
 	return cfg, nil
 }
 
@@ -83,6 +172,15 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvAllowEmpty is getEnv for settings where an empty value, as opposed to
+// an unset one, disables the feature
+func getEnvAllowEmpty(key, defaultValue string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
 func getEnvInt(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
 		if i, err := strconv.Atoi(value); err == nil {
@@ -0,0 +1,208 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/enterprisesight/es-license-validator/pkg/license"
+	"github.com/enterprisesight/es-license-validator/pkg/phonehome"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// StatusAnnotation is the Secret annotation holding the per-product license status
+const StatusAnnotation = "es-products.io/license-status"
+
+const component = "es-license-validator"
+
+// ProductStatus is the per-product entry of the status annotation
+type ProductStatus struct {
+	Status        string    `json:"status"`
+	Message       string    `json:"message"`
+	Valid         bool      `json:"valid"`
+	NodeCount     int       `json:"node_count"`
+	LicensedNodes int       `json:"licensed_nodes"`
+	LicenseID     string    `json:"license_id,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Reporter emits Kubernetes Events on the license Secret when a product's
+// validation status changes, and mirrors the statuses into an annotation.
+// Repeated identical states emit nothing.
+type Reporter struct {
+	clientset   kubernetes.Interface
+	broadcaster record.EventBroadcaster
+	recorder    record.EventRecorder
+	namespace   string
+	secretName  string
+
+	mu           sync.Mutex
+	statuses     map[string]ProductStatus // last reported status, keyed by product
+	pendingPatch bool                     // annotation could not be written yet
+}
+
+// NewReporter creates a reporter for the named license Secret
+func NewReporter(clientset kubernetes.Interface, namespace, secretName string) *Reporter {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{
+		Interface: clientset.CoreV1().Events(namespace),
+	})
+
+	return &Reporter{
+		clientset:   clientset,
+		broadcaster: broadcaster,
+		recorder:    broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: component}),
+		namespace:   namespace,
+		secretName:  secretName,
+	}
+}
+
+// Report emits events for every product whose status changed since the last
+// report and updates the status annotation. secret may be nil if it could
+// not be read; on the first report its annotation seeds the known statuses so
+// restarts do not re-emit unchanged states.
+func (r *Reporter) Report(ctx context.Context, secret *corev1.Secret, results map[string]*license.ValidationResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.statuses == nil {
+		r.statuses = existingStatuses(secret)
+	}
+
+	ref := &corev1.ObjectReference{
+		Kind:       "Secret",
+		APIVersion: "v1",
+		Namespace:  r.namespace,
+		Name:       r.secretName,
+	}
+	if secret != nil {
+		ref.UID = secret.UID
+		ref.ResourceVersion = secret.ResourceVersion
+	}
+
+	changed := false
+	statuses := make(map[string]ProductStatus, len(results))
+	for product, result := range results {
+		status := ProductStatus{
+			Status:        phonehome.ValidationStatus(result),
+			Message:       phonehome.ValidationMessage(result),
+			Valid:         result.Valid,
+			NodeCount:     result.NodeCount,
+			LicensedNodes: result.LicensedNodes,
+			UpdatedAt:     result.ValidationTime,
+		}
+		if result.License != nil {
+			status.LicenseID = result.License.LicenseID
+		}
+
+		previous, known := r.statuses[product]
+		if known && previous.Status == status.Status {
+			// Keep the time of the last transition
+			status.UpdatedAt = previous.UpdatedAt
+			statuses[product] = status
+			continue
+		}
+
+		changed = true
+		eventType := corev1.EventTypeWarning
+		if status.Status == "valid" {
+			eventType = corev1.EventTypeNormal
+		}
+		if known {
+			r.recorder.Eventf(ref, eventType, reason(status.Status),
+				"%s license changed from %s to %s: %s", product, previous.Status, status.Status, status.Message)
+		} else {
+			r.recorder.Eventf(ref, eventType, reason(status.Status),
+				"%s license is %s: %s", product, status.Status, status.Message)
+		}
+		statuses[product] = status
+	}
+	if len(statuses) != len(r.statuses) {
+		changed = true // products added or removed
+	}
+	r.statuses = statuses
+
+	if !changed && !r.pendingPatch {
+		return
+	}
+	if secret == nil {
+		r.pendingPatch = true
+		return
+	}
+	if err := r.patchAnnotation(ctx, statuses); err != nil {
+		slog.Error("Failed to update license status annotation",
+			"secret", r.secretName, "namespace", r.namespace, "error", err)
+		r.pendingPatch = true
+		return
+	}
+	r.pendingPatch = false
+}
+
+// Shutdown stops the event broadcaster, flushing pending events
+func (r *Reporter) Shutdown() {
+	r.broadcaster.Shutdown()
+}
+
+func (r *Reporter) patchAnnotation(ctx context.Context, statuses map[string]ProductStatus) error {
+	value, err := json.Marshal(statuses)
+	if err != nil {
+		return fmt.Errorf("failed to marshal status annotation: %w", err)
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				StatusAnnotation: string(value),
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal status patch: %w", err)
+	}
+
+	_, err = r.clientset.CoreV1().Secrets(r.namespace).Patch(ctx, r.secretName, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to patch secret: %w", err)
+	}
+	return nil
+}
+
+// existingStatuses reads the statuses previously written to the Secret
+func existingStatuses(secret *corev1.Secret) map[string]ProductStatus {
+	statuses := make(map[string]ProductStatus)
+	if secret == nil {
+		return statuses
+	}
+	if value, ok := secret.Annotations[StatusAnnotation]; ok {
+		if err := json.Unmarshal([]byte(value), &statuses); err != nil {
+			slog.Warn("Ignoring malformed license status annotation", "error", err)
+			return make(map[string]ProductStatus)
+		}
+	}
+	return statuses
+}
+
+// reason converts a validation status such as "node_limit_exceeded" into an
+// event reason such as "LicenseNodeLimitExceeded"
+func reason(status string) string {
+	var b strings.Builder
+	b.WriteString("License")
+	for _, part := range strings.Split(status, "_") {
+		if part == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
@@ -0,0 +1,88 @@
+package history
+
+import (
+	"sync"
+	"time"
+
+	"github.com/enterprisesight/es-license-validator/pkg/license"
+)
+
+// Entry is a recorded validation result. Consecutive results of a product in
+// the same state are collapsed into one entry.
+type Entry struct {
+	Time      time.Time // when the state was last seen
+	FirstSeen time.Time // when the product entered the state
+	Count     int       // number of runs collapsed into the entry
+	Product   string
+	State     string // validity, decision and reason; a change starts a new entry
+	Result    *license.ValidationResult
+}
+
+// History is a fixed-size ring buffer of validation state changes, safe for
+// concurrent use
+type History struct {
+	mu      sync.RWMutex
+	entries []Entry
+	next    int
+	full    bool
+}
+
+// New creates a history holding at most size entries
+func New(size int) *History {
+	if size < 1 {
+		size = 1
+	}
+	return &History{
+		entries: make([]Entry, size),
+	}
+}
+
+// Add records an entry, evicting the oldest one when full. If the product's
+// latest entry has the same state, that entry is updated instead.
+func (h *History) Add(entry Entry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if last := h.latest(entry.Product); last != nil && last.State == entry.State {
+		last.Time = entry.Time
+		last.Count++
+		last.Result = entry.Result
+		return
+	}
+
+	entry.FirstSeen = entry.Time
+	entry.Count = 1
+	h.entries[h.next] = entry
+	h.next = (h.next + 1) % len(h.entries)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// latest returns the newest entry of product, or nil if there is none
+func (h *History) latest(product string) *Entry {
+	size := h.next
+	if h.full {
+		size = len(h.entries)
+	}
+	for i := 1; i <= size; i++ {
+		entry := &h.entries[(h.next-i+len(h.entries))%len(h.entries)]
+		if entry.Product == product {
+			return entry
+		}
+	}
+	return nil
+}
+
+// Entries returns the recorded entries, oldest first
+func (h *History) Entries() []Entry {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if !h.full {
+		return append([]Entry(nil), h.entries[:h.next]...)
+	}
+	out := make([]Entry, 0, len(h.entries))
+	out = append(out, h.entries[h.next:]...)
+	return append(out, h.entries[:h.next]...)
+}
@@ -0,0 +1,65 @@
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAddCollapsesUnchangedState(t *testing.T) {
+	start := time.Date(2025, 10, 21, 0, 0, 0, 0, time.UTC)
+	runs := []struct {
+		product string
+		state   string
+	}{
+		{"es-core-gw", "valid"},
+		{"es-search", "valid"},
+		{"es-core-gw", "valid"},
+		{"es-core-gw", "valid"},
+		{"es-search", "valid"},
+		{"es-core-gw", "expired"},
+		{"es-core-gw", "expired"},
+		{"es-core-gw", "valid"},
+	}
+
+	h := New(10)
+	for i, run := range runs {
+		h.Add(Entry{Time: start.Add(time.Duration(i) * time.Minute), Product: run.product, State: run.state})
+	}
+
+	want := []struct {
+		product     string
+		state       string
+		count       int
+		first, last int // run indexes
+	}{
+		{"es-core-gw", "valid", 3, 0, 3},
+		{"es-search", "valid", 2, 1, 4},
+		{"es-core-gw", "expired", 2, 5, 6},
+		{"es-core-gw", "valid", 1, 7, 7},
+	}
+	entries := h.Entries()
+	if len(entries) != len(want) {
+		t.Fatalf("recorded %d entries, want %d: %+v", len(entries), len(want), entries)
+	}
+	for i, w := range want {
+		e := entries[i]
+		if e.Product != w.product || e.State != w.state || e.Count != w.count {
+			t.Errorf("entry %d = %s %s x%d, want %s %s x%d", i, e.Product, e.State, e.Count, w.product, w.state, w.count)
+		}
+		if !e.FirstSeen.Equal(start.Add(time.Duration(w.first)*time.Minute)) || !e.Time.Equal(start.Add(time.Duration(w.last)*time.Minute)) {
+			t.Errorf("entry %d seen %s to %s, want runs %d to %d", i, e.FirstSeen, e.Time, w.first, w.last)
+		}
+	}
+}
+
+func TestAddEvictsOldest(t *testing.T) {
+	h := New(2)
+	for _, state := range []string{"valid", "expired", "revoked"} {
+		h.Add(Entry{Product: "es-core-gw", State: state})
+	}
+
+	entries := h.Entries()
+	if len(entries) != 2 || entries[0].State != "expired" || entries[1].State != "revoked" {
+		t.Errorf("entries = %+v, want expired then revoked", entries)
+	}
+}
@@ -0,0 +1,99 @@
+package license
+
+import "fmt"
+
+// Capacity dimensions a license can limit
+const (
+	DimensionNodes     = "nodes"
+	DimensionVCPUs     = "vcpus"
+	DimensionMemoryGiB = "memory_gib"
+	DimensionGPUs      = "gpus"
+)
+
+// Capacity is the node count and allocatable capacity of the nodes matching
+// a license's node selector
+type Capacity struct {
+	Nodes     int
+	VCPUs     float64
+	MemoryGiB float64
+	GPUs      int
+}
+
+// Value returns the capacity in the given dimension
+func (c Capacity) Value(dimension string) float64 {
+	switch dimension {
+	case DimensionNodes:
+		return float64(c.Nodes)
+	case DimensionVCPUs:
+		return c.VCPUs
+	case DimensionMemoryGiB:
+		return c.MemoryGiB
+	case DimensionGPUs:
+		return float64(c.GPUs)
+	}
+	return 0
+}
+
+// CapacityFunc measures the nodes matching a license's node selector. An
+// empty selector means the validator's configured default label.
+type CapacityFunc func(selector map[string]string) (Capacity, error)
+
+// Limit is a licensed maximum in one capacity dimension. Max, when set, is a
+// hard limit above Licensed; usage in between is overage.
+type Limit struct {
+	Dimension string
+	Licensed  float64
+	Max       float64
+}
+
+// DimensionResult is the check of one capacity dimension the license limits
+type DimensionResult struct {
+	Dimension string
+	Used      float64
+	Licensed  float64
+	Max       float64 // zero when Licensed is the hard limit
+	Valid     bool    // within the hard limit
+	Overage   bool    // above Licensed but within Max
+}
+
+// String describes the check, e.g. "vcpus 40 of 32 licensed"
+func (d DimensionResult) String() string {
+	if d.Max > 0 {
+		return fmt.Sprintf("%s %g of %g licensed (max %g)", d.Dimension, d.Used, d.Licensed, d.Max)
+	}
+	return fmt.Sprintf("%s %g of %g licensed", d.Dimension, d.Used, d.Licensed)
+}
+
+// check compares used against the limit
+func (l Limit) check(used float64) DimensionResult {
+	limit := l.Licensed
+	if l.Max > 0 {
+		limit = l.Max
+	}
+	return DimensionResult{
+		Dimension: l.Dimension,
+		Used:      used,
+		Licensed:  l.Licensed,
+		Max:       l.Max,
+		Valid:     used <= limit,
+		Overage:   used > l.Licensed && used <= limit,
+	}
+}
+
+// Limits returns the capacity dimensions the product's license declares
+func (p ProductLicense) Limits() []Limit {
+	var limits []Limit
+	if p.NodesLimited {
+		limits = append(limits, Limit{Dimension: DimensionNodes, Licensed: float64(p.LicensedNodes), Max: float64(p.MaxNodes)})
+	}
+	if p.LicensedVCPUs > 0 {
+		limits = append(limits, Limit{Dimension: DimensionVCPUs, Licensed: p.LicensedVCPUs})
+	}
+	if p.LicensedMemoryGiB > 0 {
+		limits = append(limits, Limit{Dimension: DimensionMemoryGiB, Licensed: p.LicensedMemoryGiB})
+	}
+	if p.LicensedGPUs > 0 {
+		limits = append(limits, Limit{Dimension: DimensionGPUs, Licensed: float64(p.LicensedGPUs)})
+	}
+	return limits
+}
@@ -0,0 +1,397 @@
+package license
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// MissingClaimError reports a required claim absent from the license
+type MissingClaimError struct {
+	Claim string
+}
+
+func (e *MissingClaimError) Error() string {
+	return fmt.Sprintf("missing required claim %s", e.Claim)
+}
+
+// InvalidClaimError reports a claim with the wrong type or an invalid value
+type InvalidClaimError struct {
+	Claim  string
+	Reason string
+}
+
+func (e *InvalidClaimError) Error() string {
+	return fmt.Sprintf("invalid claim %s: %s", e.Claim, e.Reason)
+}
+
+// IssuerMismatchError reports a license issued by an unexpected issuer
+type IssuerMismatchError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *IssuerMismatchError) Error() string {
+	return fmt.Sprintf("license issuer %q does not match expected issuer %q", e.Actual, e.Expected)
+}
+
+// AudienceMismatchError reports a license not intended for this validator
+type AudienceMismatchError struct {
+	Expected string
+	Actual   []string
+}
+
+func (e *AudienceMismatchError) Error() string {
+	return fmt.Sprintf("license audience %q does not include expected audience %q", e.Actual, e.Expected)
+}
+
+// licenseClaims is the schema of a license JWT. Pointer fields distinguish
+// required claims that are missing from zero values.
+type licenseClaims struct {
+	// Standard JWT claims
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  audience `json:"aud"`
+	IssuedAt  *float64 `json:"iat"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+	JTI       string   `json:"jti"`
+
+	// Custom claims
+	LicenseID       string          `json:"license_id"`
+	CustomerID      string          `json:"customer_id"`
+	CustomerName    string          `json:"customer_name"`
+	ProductCode     string          `json:"product_code"`
+	ProductName     string          `json:"product_name"`
+	TierCode        string          `json:"tier_code"`
+	TierName        string          `json:"tier_name"`
+	ClusterID       string          `json:"cluster_id"`
+	ClusterName     string          `json:"cluster_name"`
+	Namespace       string          `json:"namespace"`
+	LicensedNodes   *int            `json:"licensed_nodes"`
+	MaxNodes        int             `json:"max_nodes"`
+	NodeSelector    nodeSelector    `json:"node_selector"`
+	Features        []string        `json:"features"`
+	GracePeriodDays int             `json:"grace_period_days"`
+	WarningDays     int             `json:"warning_days"`
+	PhoneHome       PhoneHomeConfig `json:"phone_home"`
+	Products        []productClaims `json:"products"`
+
+	capacityClaims
+}
+
+// capacityClaims are the capacity limits of a flat license or a product
+type capacityClaims struct {
+	LicensedVCPUs     *float64 `json:"licensed_vcpus"`
+	LicensedMemoryGiB *float64 `json:"licensed_memory_gib"`
+	LicensedGPUs      *int     `json:"licensed_gpus"`
+}
+
+// productClaims is the schema of an entry of the products claim
+type productClaims struct {
+	ProductCode   string       `json:"product_code"`
+	ProductName   string       `json:"product_name"`
+	TierCode      string       `json:"tier_code"`
+	TierName      string       `json:"tier_name"`
+	LicensedNodes *int         `json:"licensed_nodes"`
+	MaxNodes      int          `json:"max_nodes"`
+	NodeSelector  nodeSelector `json:"node_selector"`
+	Features      []string     `json:"features"`
+
+	capacityClaims
+}
+
+// audience is the aud claim, either a single string or an array of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return &InvalidClaimError{Claim: "aud", Reason: "must be a string or an array of strings"}
+	}
+	*a = multiple
+	return nil
+}
+
+// nodeSelector is a node_selector claim, either a label map or a
+// "key=value,key2=value2" string
+type nodeSelector map[string]string
+
+func (s *nodeSelector) UnmarshalJSON(data []byte) error {
+	var selector map[string]string
+	if err := json.Unmarshal(data, &selector); err == nil {
+		*s = selector
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return &InvalidClaimError{Claim: "node_selector", Reason: "must be an object of label values or a selector string"}
+	}
+	selector, err := labels.ConvertSelectorToLabelsMap(str)
+	if err != nil {
+		return &InvalidClaimError{Claim: "node_selector", Reason: fmt.Sprintf("invalid selector %q: %v", str, err)}
+	}
+	*s = selector
+	return nil
+}
+
+// parseLicense decodes verified claims into a License, checking them against
+// the license schema and the expected issuer and audience. Every problem is
+// returned as a typed error, joined with errors.Join.
+func parseLicense(claims *jwt.MapClaims, expectedIssuer, expectedAudience string) (*License, error) {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode claims: %w", err)
+	}
+
+	var c licenseClaims
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, claimError(err)
+	}
+
+	if err := c.validate(expectedIssuer, expectedAudience); err != nil {
+		return nil, err
+	}
+	return c.license(), nil
+}
+
+// validate checks required claims and the expected issuer and audience
+func (c *licenseClaims) validate(expectedIssuer, expectedAudience string) error {
+	var errs []error
+
+	if c.LicenseID == "" {
+		errs = append(errs, &MissingClaimError{Claim: "license_id"})
+	}
+	if c.ExpiresAt == nil {
+		errs = append(errs, &MissingClaimError{Claim: "exp"})
+	}
+	if c.Namespace == "" {
+		errs = append(errs, &MissingClaimError{Claim: "namespace"})
+	}
+
+	if c.Products == nil {
+		// Flat single-product license
+		errs = append(errs, validateLimits("", c.LicensedNodes, c.MaxNodes, c.capacityClaims)...)
+	} else {
+		if len(c.Products) == 0 {
+			errs = append(errs, &InvalidClaimError{Claim: "products", Reason: "must not be empty"})
+		}
+		// Limits only apply per product; license-wide ones would be ignored
+		for _, limit := range []struct {
+			claim string
+			set   bool
+		}{
+			{"licensed_nodes", c.LicensedNodes != nil},
+			{"max_nodes", c.MaxNodes != 0},
+			{"licensed_vcpus", c.LicensedVCPUs != nil},
+			{"licensed_memory_gib", c.LicensedMemoryGiB != nil},
+			{"licensed_gpus", c.LicensedGPUs != nil},
+		} {
+			if limit.set {
+				errs = append(errs, &InvalidClaimError{Claim: limit.claim, Reason: "must be set per product when products is present"})
+			}
+		}
+		for i, product := range c.Products {
+			prefix := fmt.Sprintf("products[%d].", i)
+			if product.ProductCode == "" {
+				errs = append(errs, &MissingClaimError{Claim: prefix + "product_code"})
+			}
+			errs = append(errs, validateLimits(prefix, product.LicensedNodes, product.MaxNodes, product.capacityClaims)...)
+		}
+	}
+
+	if expectedIssuer != "" && c.Issuer != expectedIssuer {
+		errs = append(errs, &IssuerMismatchError{Expected: expectedIssuer, Actual: c.Issuer})
+	}
+	if expectedAudience != "" && !contains(c.Audience, expectedAudience) {
+		errs = append(errs, &AudienceMismatchError{Expected: expectedAudience, Actual: c.Audience})
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateLimits checks the node and capacity limits of a flat license or a
+// product. licensed_nodes is required unless a capacity limit is declared;
+// max_nodes, if set, raises the hard node limit above it.
+func validateLimits(prefix string, licensedNodes *int, maxNodes int, capacity capacityClaims) []error {
+	var errs []error
+	if licensedNodes == nil && !capacity.declared() {
+		errs = append(errs, &MissingClaimError{Claim: prefix + "licensed_nodes"})
+	}
+	if licensedNodes != nil && *licensedNodes < 0 {
+		errs = append(errs, &InvalidClaimError{Claim: prefix + "licensed_nodes", Reason: "must not be negative"})
+	}
+	if maxNodes != 0 {
+		switch {
+		case licensedNodes == nil:
+			errs = append(errs, &InvalidClaimError{Claim: prefix + "max_nodes", Reason: "requires licensed_nodes"})
+		case maxNodes < *licensedNodes:
+			errs = append(errs, &InvalidClaimError{Claim: prefix + "max_nodes", Reason: "must not be less than licensed_nodes"})
+		}
+	}
+	if capacity.LicensedVCPUs != nil && *capacity.LicensedVCPUs <= 0 {
+		errs = append(errs, &InvalidClaimError{Claim: prefix + "licensed_vcpus", Reason: "must be positive"})
+	}
+	if capacity.LicensedMemoryGiB != nil && *capacity.LicensedMemoryGiB <= 0 {
+		errs = append(errs, &InvalidClaimError{Claim: prefix + "licensed_memory_gib", Reason: "must be positive"})
+	}
+	if capacity.LicensedGPUs != nil && *capacity.LicensedGPUs <= 0 {
+		errs = append(errs, &InvalidClaimError{Claim: prefix + "licensed_gpus", Reason: "must be positive"})
+	}
+	return errs
+}
+
+// declared reports whether any capacity limit is set
+func (c capacityClaims) declared() bool {
+	return c.LicensedVCPUs != nil || c.LicensedMemoryGiB != nil || c.LicensedGPUs != nil
+}
+
+// apply copies the capacity limits into a product entitlement
+func (c capacityClaims) apply(product *ProductLicense) {
+	if c.LicensedVCPUs != nil {
+		product.LicensedVCPUs = *c.LicensedVCPUs
+	}
+	if c.LicensedMemoryGiB != nil {
+		product.LicensedMemoryGiB = *c.LicensedMemoryGiB
+	}
+	if c.LicensedGPUs != nil {
+		product.LicensedGPUs = *c.LicensedGPUs
+	}
+}
+
+// license converts validated claims into a License
+func (c *licenseClaims) license() *License {
+	license := &License{
+		Issuer:          c.Issuer,
+		Subject:         c.Subject,
+		Audience:        c.Audience,
+		IssuedAt:        unixTime(c.IssuedAt),
+		ExpiresAt:       unixTime(c.ExpiresAt),
+		NotBefore:       unixTime(c.NotBefore),
+		JTI:             c.JTI,
+		LicenseID:       c.LicenseID,
+		CustomerID:      c.CustomerID,
+		CustomerName:    c.CustomerName,
+		ProductCode:     c.ProductCode,
+		ProductName:     c.ProductName,
+		TierCode:        c.TierCode,
+		TierName:        c.TierName,
+		ClusterID:       c.ClusterID,
+		ClusterName:     c.ClusterName,
+		Namespace:       c.Namespace,
+		MaxNodes:        c.MaxNodes,
+		NodeSelector:    c.NodeSelector,
+		Features:        c.Features,
+		GracePeriodDays: c.GracePeriodDays,
+		WarningDays:     c.WarningDays,
+		PhoneHomeConfig: c.PhoneHome,
+	}
+	if c.LicensedNodes != nil {
+		license.LicensedNodes = *c.LicensedNodes
+	}
+
+	if c.Products == nil {
+		// Flat single-product license
+		product := ProductLicense{
+			ProductCode:   license.ProductCode,
+			ProductName:   license.ProductName,
+			TierCode:      license.TierCode,
+			TierName:      license.TierName,
+			LicensedNodes: license.LicensedNodes,
+			MaxNodes:      license.MaxNodes,
+			NodeSelector:  license.NodeSelector,
+			Features:      license.Features,
+			NodesLimited:  c.LicensedNodes != nil,
+		}
+		c.capacityClaims.apply(&product)
+		license.LicensedVCPUs = product.LicensedVCPUs
+		license.LicensedMemoryGiB = product.LicensedMemoryGiB
+		license.LicensedGPUs = product.LicensedGPUs
+		license.Products = []ProductLicense{product}
+		return license
+	}
+
+	license.Products = make([]ProductLicense, 0, len(c.Products))
+	for _, p := range c.Products {
+		product := ProductLicense{
+			ProductCode:  p.ProductCode,
+			ProductName:  p.ProductName,
+			TierCode:     p.TierCode,
+			TierName:     p.TierName,
+			MaxNodes:     p.MaxNodes,
+			NodeSelector: p.NodeSelector,
+			Features:     p.Features,
+			NodesLimited: p.LicensedNodes != nil,
+		}
+		if p.LicensedNodes != nil {
+			product.LicensedNodes = *p.LicensedNodes
+		}
+		p.capacityClaims.apply(&product)
+		// Products without their own selector share the license-wide one
+		if len(product.NodeSelector) == 0 {
+			product.NodeSelector = license.NodeSelector
+		}
+		license.Products = append(license.Products, product)
+	}
+	return license
+}
+
+// claimError converts a claim decoding error into a typed claim error
+func claimError(err error) error {
+	var claimErr *InvalidClaimError
+	if errors.As(err, &claimErr) {
+		return claimErr
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return &InvalidClaimError{
+			Claim:  arrayIndex.ReplaceAllString(typeErr.Field, "[$1]"),
+			Reason: fmt.Sprintf("must be %s, got %s", jsonType(typeErr.Type), typeErr.Value),
+		}
+	}
+	return fmt.Errorf("failed to decode claims: %w", err)
+}
+
+// arrayIndex matches array indexes in decoding error paths such as
+// "products.0.licensed_nodes"
+var arrayIndex = regexp.MustCompile(`\.(\d+)`)
+
+// jsonType describes the JSON type expected for a Go type
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return jsonType(t.Elem())
+	case reflect.Int, reflect.Int64:
+		return "an integer"
+	case reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice:
+		return "an array"
+	}
+	return "an object"
+}
+
+// unixTime converts a NumericDate claim to a time; nil is the zero time
+func unixTime(seconds *float64) time.Time {
+	if seconds == nil {
+		return time.Time{}
+	}
+	sec, frac := math.Modf(*seconds)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
@@ -0,0 +1,246 @@
+package license
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// validClaims returns the claims of a valid flat license
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            "https://license.es-products.io",
+		"aud":            "es-license-validator",
+		"exp":            float64(1893456000),
+		"license_id":     "lic-1",
+		"namespace":      "es-core",
+		"product_code":   "es-core-gw",
+		"licensed_nodes": float64(3),
+	}
+}
+
+func TestParseLicenseClaims(t *testing.T) {
+	tests := []struct {
+		name             string
+		mutate           func(jwt.MapClaims)
+		issuer           string
+		audience         string
+		missing          []string // claims expected in MissingClaimErrors
+		invalid          []string // claims expected in InvalidClaimErrors
+		issuerMismatch   bool
+		audienceMismatch bool
+	}{
+		{
+			name:   "valid",
+			mutate: func(jwt.MapClaims) {},
+		},
+		{
+			name:     "valid with expected issuer and audience list",
+			mutate:   func(c jwt.MapClaims) { c["aud"] = []interface{}{"other", "es-license-validator"} },
+			issuer:   "https://license.es-products.io",
+			audience: "es-license-validator",
+		},
+		{
+			name:    "missing license_id",
+			mutate:  func(c jwt.MapClaims) { delete(c, "license_id") },
+			missing: []string{"license_id"},
+		},
+		{
+			name:    "missing exp",
+			mutate:  func(c jwt.MapClaims) { delete(c, "exp") },
+			missing: []string{"exp"},
+		},
+		{
+			name:    "missing namespace",
+			mutate:  func(c jwt.MapClaims) { delete(c, "namespace") },
+			missing: []string{"namespace"},
+		},
+		{
+			name:    "missing licensed_nodes without capacity limits",
+			mutate:  func(c jwt.MapClaims) { delete(c, "licensed_nodes") },
+			missing: []string{"licensed_nodes"},
+		},
+		{
+			name: "capacity limit replaces licensed_nodes",
+			mutate: func(c jwt.MapClaims) {
+				delete(c, "licensed_nodes")
+				c["licensed_vcpus"] = float64(64)
+			},
+		},
+		{
+			name: "several missing claims are all reported",
+			mutate: func(c jwt.MapClaims) {
+				delete(c, "license_id")
+				delete(c, "exp")
+				delete(c, "namespace")
+			},
+			missing: []string{"license_id", "exp", "namespace"},
+		},
+		{
+			name: "missing product_code in products",
+			mutate: func(c jwt.MapClaims) {
+				delete(c, "licensed_nodes")
+				c["products"] = []interface{}{map[string]interface{}{"licensed_nodes": float64(2)}}
+			},
+			missing: []string{"products[0].product_code"},
+		},
+		{
+			name:    "empty products",
+			mutate:  func(c jwt.MapClaims) { delete(c, "licensed_nodes"); c["products"] = []interface{}{} },
+			invalid: []string{"products"},
+		},
+		{
+			name: "valid products",
+			mutate: func(c jwt.MapClaims) {
+				delete(c, "licensed_nodes")
+				c["products"] = []interface{}{map[string]interface{}{"product_code": "es-core-gw", "licensed_nodes": float64(2)}}
+			},
+		},
+		{
+			name: "products with top-level licensed_nodes",
+			mutate: func(c jwt.MapClaims) {
+				c["products"] = []interface{}{map[string]interface{}{"product_code": "es-core-gw", "licensed_nodes": float64(2)}}
+			},
+			invalid: []string{"licensed_nodes"},
+		},
+		{
+			name: "products with top-level max_nodes and capacity",
+			mutate: func(c jwt.MapClaims) {
+				delete(c, "licensed_nodes")
+				c["max_nodes"] = float64(5)
+				c["licensed_vcpus"] = float64(64)
+				c["products"] = []interface{}{map[string]interface{}{"product_code": "es-core-gw", "licensed_nodes": float64(2)}}
+			},
+			invalid: []string{"max_nodes", "licensed_vcpus"},
+		},
+		{
+			name:    "licensed_nodes of the wrong type",
+			mutate:  func(c jwt.MapClaims) { c["licensed_nodes"] = "three" },
+			invalid: []string{"licensed_nodes"},
+		},
+		{
+			name:    "exp of the wrong type",
+			mutate:  func(c jwt.MapClaims) { c["exp"] = "tomorrow" },
+			invalid: []string{"exp"},
+		},
+		{
+			name:    "features of the wrong type",
+			mutate:  func(c jwt.MapClaims) { c["features"] = "sso" },
+			invalid: []string{"features"},
+		},
+		{
+			name: "product licensed_nodes of the wrong type",
+			mutate: func(c jwt.MapClaims) {
+				delete(c, "licensed_nodes")
+				c["products"] = []interface{}{map[string]interface{}{"product_code": "es-core-gw", "licensed_nodes": true}}
+			},
+			invalid: []string{"products[0].licensed_nodes"},
+		},
+		{
+			name:    "aud of the wrong type",
+			mutate:  func(c jwt.MapClaims) { c["aud"] = float64(1) },
+			invalid: []string{"aud"},
+		},
+		{
+			name:    "node_selector of the wrong type",
+			mutate:  func(c jwt.MapClaims) { c["node_selector"] = float64(1) },
+			invalid: []string{"node_selector"},
+		},
+		{
+			name:           "issuer mismatch",
+			mutate:         func(c jwt.MapClaims) { c["iss"] = "https://attacker.example" },
+			issuer:         "https://license.es-products.io",
+			issuerMismatch: true,
+		},
+		{
+			name:           "missing issuer when one is expected",
+			mutate:         func(c jwt.MapClaims) { delete(c, "iss") },
+			issuer:         "https://license.es-products.io",
+			issuerMismatch: true,
+		},
+		{
+			name:             "audience mismatch",
+			mutate:           func(c jwt.MapClaims) { c["aud"] = []interface{}{"other"} },
+			audience:         "es-license-validator",
+			audienceMismatch: true,
+		},
+		{
+			name:             "missing audience when one is expected",
+			mutate:           func(c jwt.MapClaims) { delete(c, "aud") },
+			audience:         "es-license-validator",
+			audienceMismatch: true,
+		},
+		{
+			name:   "issuer and audience unchecked when not configured",
+			mutate: func(c jwt.MapClaims) { c["iss"] = "anyone"; c["aud"] = "anything" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			tt.mutate(claims)
+
+			license, err := parseLicense(&claims, tt.issuer, tt.audience)
+
+			wantErr := len(tt.missing) > 0 || len(tt.invalid) > 0 || tt.issuerMismatch || tt.audienceMismatch
+			if !wantErr {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if license.LicenseID != "lic-1" {
+					t.Errorf("license_id = %q, want lic-1", license.LicenseID)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			missing, invalid := map[string]bool{}, map[string]bool{}
+			var issuerMismatch, audienceMismatch bool
+			for _, e := range unjoin(err) {
+				var missingErr *MissingClaimError
+				var invalidErr *InvalidClaimError
+				switch {
+				case errors.As(e, &missingErr):
+					missing[missingErr.Claim] = true
+				case errors.As(e, &invalidErr):
+					invalid[invalidErr.Claim] = true
+				case errors.As(e, new(*IssuerMismatchError)):
+					issuerMismatch = true
+				case errors.As(e, new(*AudienceMismatchError)):
+					audienceMismatch = true
+				default:
+					t.Errorf("untyped error: %v", e)
+				}
+			}
+
+			for _, claim := range tt.missing {
+				if !missing[claim] {
+					t.Errorf("missing claim %s not reported in %v", claim, err)
+				}
+			}
+			for _, claim := range tt.invalid {
+				if !invalid[claim] {
+					t.Errorf("invalid claim %s not reported in %v", claim, err)
+				}
+			}
+			if issuerMismatch != tt.issuerMismatch {
+				t.Errorf("issuer mismatch = %v, want %v (%v)", issuerMismatch, tt.issuerMismatch, err)
+			}
+			if audienceMismatch != tt.audienceMismatch {
+				t.Errorf("audience mismatch = %v, want %v (%v)", audienceMismatch, tt.audienceMismatch, err)
+			}
+		})
+	}
+}
+
+// unjoin splits an errors.Join error into its errors
+func unjoin(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
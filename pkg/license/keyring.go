@@ -0,0 +1,376 @@
+package license
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PEM block headers carrying key metadata in a PEM bundle, e.g.
+//
+//	-----BEGIN PUBLIC KEY-----
+//	Key-Id: es-2025
+//	Not-After: 2026-06-30T00:00:00Z
+//
+//	MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA...
+//	-----END PUBLIC KEY-----
+const (
+	pemHeaderKeyID     = "Key-Id"
+	pemHeaderNotBefore = "Not-Before"
+	pemHeaderNotAfter  = "Not-After"
+)
+
+// PublicKey is a trusted license signing key
+type PublicKey struct {
+	ID         string           // matched against the JWT "kid" header
+	Key        crypto.PublicKey // *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey
+	Algorithms []string         // JWT algorithms the key may verify
+	NotBefore  time.Time        // zero means no lower bound
+	NotAfter   time.Time        // zero means no upper bound
+}
+
+// newPublicKey wraps a parsed key, restricting it to the algorithms matching
+// its type. A non-empty alg pins the key to that single algorithm.
+func newPublicKey(id string, key crypto.PublicKey, alg string) (PublicKey, error) {
+	algorithms, err := keyAlgorithms(key)
+	if err != nil {
+		return PublicKey{}, err
+	}
+	if alg != "" {
+		if !contains(algorithms, alg) {
+			return PublicKey{}, fmt.Errorf("algorithm %s does not match the key type", alg)
+		}
+		algorithms = []string{alg}
+	}
+	return PublicKey{ID: id, Key: key, Algorithms: algorithms}, nil
+}
+
+// keyAlgorithms returns the JWT algorithms that match a key's type
+func keyAlgorithms(key crypto.PublicKey) ([]string, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512"}, nil
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return []string{"ES256"}, nil
+		case elliptic.P384():
+			return []string{"ES384"}, nil
+		}
+		return nil, fmt.Errorf("unsupported elliptic curve %s", k.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return []string{"EdDSA"}, nil
+	}
+	return nil, fmt.Errorf("unsupported public key type %T", key)
+}
+
+// Type returns the key type: "RSA", "EC" or "Ed25519"
+func (k PublicKey) Type() string {
+	switch k.Key.(type) {
+	case *rsa.PublicKey:
+		return "RSA"
+	case *ecdsa.PublicKey:
+		return "EC"
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return "unknown"
+}
+
+// Allows reports whether the key may verify tokens signed with alg
+func (k PublicKey) Allows(alg string) bool {
+	return contains(k.Algorithms, alg)
+}
+
+// ActiveAt reports whether the key is within its validity window at t. A
+// zero t, e.g. for a license without iat, is only within keys without one.
+func (k PublicKey) ActiveAt(t time.Time) bool {
+	if t.IsZero() {
+		return k.NotBefore.IsZero() && k.NotAfter.IsZero()
+	}
+	if !k.NotBefore.IsZero() && t.Before(k.NotBefore) {
+		return false
+	}
+	if !k.NotAfter.IsZero() && t.After(k.NotAfter) {
+		return false
+	}
+	return true
+}
+
+// Keyring holds the trusted license signing keys. It is safe for concurrent
+// use and can be replaced at runtime when the key file changes.
+type Keyring struct {
+	mu   sync.RWMutex
+	keys []PublicKey
+}
+
+// NewKeyring creates a keyring holding the given keys
+func NewKeyring(keys []PublicKey) *Keyring {
+	return &Keyring{keys: keys}
+}
+
+// Keys returns the keys in the keyring
+func (k *Keyring) Keys() []PublicKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return append([]PublicKey(nil), k.keys...)
+}
+
+// Replace swaps in a new set of keys
+func (k *Keyring) Replace(keys []PublicKey) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = keys
+}
+
+// lookup returns the keys that may verify a token with the given kid and alg
+// issued at t (zero without iat): the key with that ID, or every matching key
+// active at t when the token has no kid. A kid no key carries falls back to the keys without an ID, e.g. PEM
+// keys, which cannot be named.
+func (k *Keyring) lookup(kid, alg string, t time.Time) ([]PublicKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	var keys []PublicKey
+	for _, key := range k.keys {
+		if kid != "" && key.ID != kid {
+			continue
+		}
+		if !key.Allows(alg) {
+			if kid != "" {
+				return nil, fmt.Errorf("signing key %q (%s) does not support algorithm %s", kid, key.Type(), alg)
+			}
+			continue
+		}
+		if !key.ActiveAt(t) {
+			if kid != "" && t.IsZero() {
+				return nil, fmt.Errorf("signing key %q has a validity window but the token has no iat", kid)
+			}
+			if kid != "" {
+				return nil, fmt.Errorf("signing key %q is outside its validity window", kid)
+			}
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 && kid != "" {
+		for _, key := range k.keys {
+			if key.ID == "" && key.Allows(alg) && key.ActiveAt(t) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	if len(keys) == 0 {
+		if kid != "" {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		return nil, fmt.Errorf("no active signing keys for algorithm %s", alg)
+	}
+	return keys, nil
+}
+
+// ParseKeys parses a PEM bundle or a JWKS document into public keys
+func ParseKeys(data []byte) ([]PublicKey, error) {
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "{") {
+		return parseJWKS([]byte(trimmed))
+	}
+	return parsePEMBundle([]byte(trimmed))
+}
+
+// parsePEMBundle parses every PUBLIC KEY block of a PEM bundle
+func parsePEMBundle(data []byte) ([]PublicKey, error) {
+	var keys []PublicKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "PUBLIC KEY" {
+			continue
+		}
+
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key %d: %w", len(keys)+1, err)
+		}
+		key, err := newPublicKey(block.Headers[pemHeaderKeyID], pub, "")
+		if err != nil {
+			return nil, fmt.Errorf("public key %d: %w", len(keys)+1, err)
+		}
+		if key.NotBefore, err = parseKeyTime(block.Headers[pemHeaderNotBefore]); err != nil {
+			return nil, fmt.Errorf("public key %d: invalid %s: %w", len(keys)+1, pemHeaderNotBefore, err)
+		}
+		if key.NotAfter, err = parseKeyTime(block.Headers[pemHeaderNotAfter]); err != nil {
+			return nil, fmt.Errorf("public key %d: invalid %s: %w", len(keys)+1, pemHeaderNotAfter, err)
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("failed to parse PEM block containing the public key")
+	}
+	return keys, nil
+}
+
+// jwk is the subset of a JSON Web Key used for license signing keys. nbf and
+// exp bound the key's validity window (Unix seconds).
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	Nbf int64  `json:"nbf"`
+	Exp int64  `json:"exp"`
+}
+
+// parseJWKS parses a JSON Web Key Set
+func parseJWKS(data []byte) ([]PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	keys := make([]PublicKey, 0, len(set.Keys))
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var pub crypto.PublicKey
+		var err error
+		switch k.Kty {
+		case "RSA":
+			pub, err = rsaKeyFromJWK(k)
+		case "EC":
+			pub, err = ecdsaKeyFromJWK(k)
+		case "OKP":
+			pub, err = ed25519KeyFromJWK(k)
+		default:
+			err = fmt.Errorf("unsupported key type %q", k.Kty)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("JWKS key %d: %w", i, err)
+		}
+
+		key, err := newPublicKey(k.Kid, pub, k.Alg)
+		if err != nil {
+			return nil, fmt.Errorf("JWKS key %d: %w", i, err)
+		}
+		if k.Nbf != 0 {
+			key.NotBefore = time.Unix(k.Nbf, 0)
+		}
+		if k.Exp != 0 {
+			key.NotAfter = time.Unix(k.Exp, 0)
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS contains no signing keys")
+	}
+	return keys, nil
+}
+
+func rsaKeyFromJWK(k jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("exponent too large")
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(exponent.Int64()),
+	}, nil
+}
+
+func ecdsaKeyFromJWK(k jwk) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("invalid x coordinate: %w", err)
+	}
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, fmt.Errorf("invalid y coordinate: %w", err)
+	}
+
+	pub := &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}
+	if !curve.IsOnCurve(pub.X, pub.Y) {
+		return nil, fmt.Errorf("point is not on curve %s", k.Crv)
+	}
+	return pub, nil
+}
+
+func ed25519KeyFromJWK(k jwk) (ed25519.PublicKey, error) {
+	if k.Crv != "Ed25519" {
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("invalid x coordinate: %w", err)
+	}
+	if len(x) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid Ed25519 key length %d", len(x))
+	}
+	return ed25519.PublicKey(x), nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// parseKeyTime parses an RFC 3339 time or Unix seconds; empty means unset
+func parseKeyTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,287 @@
+package license
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestParseKeysPEMHeaders(t *testing.T) {
+	der, err := x509.MarshalPKIXPublicKey(&testKey().PublicKey)
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %v", err)
+	}
+	bundle := string(pem.EncodeToMemory(&pem.Block{
+		Type:    "PUBLIC KEY",
+		Headers: map[string]string{"Key-Id": "es-2025", "Not-Before": "2025-01-01T00:00:00Z", "Not-After": "1782777600"},
+		Bytes:   der,
+	})) + publicKeyPEM(t, testKey())
+
+	keys, err := ParseKeys([]byte(bundle))
+	if err != nil {
+		t.Fatalf("ParseKeys: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("parsed %d keys, want 2", len(keys))
+	}
+
+	if keys[0].ID != "es-2025" {
+		t.Errorf("key ID = %q, want es-2025", keys[0].ID)
+	}
+	if want := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC); !keys[0].NotBefore.Equal(want) {
+		t.Errorf("not before = %s, want %s", keys[0].NotBefore, want)
+	}
+	if want := time.Unix(1782777600, 0); !keys[0].NotAfter.Equal(want) {
+		t.Errorf("not after = %s, want %s", keys[0].NotAfter, want)
+	}
+	if keys[1].ID != "" || !keys[1].NotBefore.IsZero() || !keys[1].NotAfter.IsZero() {
+		t.Errorf("key without headers = %+v, want no ID or window", keys[1])
+	}
+	if !keys[0].Allows("RS256") || keys[0].Allows("ES256") {
+		t.Errorf("RSA key algorithms = %v", keys[0].Algorithms)
+	}
+}
+
+func TestParseKeysJWKS(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	rsaKey := testKey().PublicKey
+
+	set, err := json.Marshal(map[string]interface{}{"keys": []map[string]interface{}{
+		{"kty": "RSA", "kid": "rsa", "alg": "RS256", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes()), "exp": 1782777600},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes())},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64(edKey)},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+	}})
+	if err != nil {
+		t.Fatalf("failed to marshal JWKS: %v", err)
+	}
+
+	keys, err := ParseKeys(set)
+	if err != nil {
+		t.Fatalf("ParseKeys: %v", err)
+	}
+	if len(keys) != 3 {
+		t.Fatalf("parsed %d keys, want 3 (encryption keys skipped)", len(keys))
+	}
+
+	want := []struct {
+		id, typ    string
+		algorithms []string
+	}{
+		{"rsa", "RSA", []string{"RS256"}},
+		{"ec", "EC", []string{"ES256"}},
+		{"ed", "Ed25519", []string{"EdDSA"}},
+	}
+	for i, w := range want {
+		if keys[i].ID != w.id || keys[i].Type() != w.typ {
+			t.Errorf("key %d = %s (%s), want %s (%s)", i, keys[i].ID, keys[i].Type(), w.id, w.typ)
+		}
+		if len(keys[i].Algorithms) != len(w.algorithms) || keys[i].Algorithms[0] != w.algorithms[0] {
+			t.Errorf("key %s algorithms = %v, want %v", w.id, keys[i].Algorithms, w.algorithms)
+		}
+	}
+	if !keys[0].NotAfter.Equal(time.Unix(1782777600, 0)) {
+		t.Errorf("key rsa not after = %s", keys[0].NotAfter)
+	}
+}
+
+func TestParseKeysErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "empty", data: ""},
+		{name: "not a key", data: "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"},
+		{name: "invalid JWKS", data: `{"keys": [`},
+		{name: "JWKS without signing keys", data: `{"keys": []}`},
+		{name: "unsupported key type", data: `{"keys": [{"kty": "oct", "k": "c2VjcmV0"}]}`},
+		{name: "algorithm not matching the key", data: `{"keys": [{"kty": "OKP", "crv": "Ed25519", "alg": "RS256", "x": "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseKeys([]byte(tt.data)); err == nil {
+				t.Error("ParseKeys succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestKeyringLookup(t *testing.T) {
+	issued := time.Date(2025, 10, 21, 0, 0, 0, 0, time.UTC)
+	rsaKey := &testKey().PublicKey
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	current, _ := newPublicKey("current", rsaKey, "")
+	retired, _ := newPublicKey("retired", rsaKey, "")
+	retired.NotAfter = issued.Add(-time.Hour)
+	ec, _ := newPublicKey("ec", &ecKey.PublicKey, "")
+	unnamed, _ := newPublicKey("", rsaKey, "")
+
+	tests := []struct {
+		name    string
+		keys    []PublicKey
+		kid     string
+		alg     string
+		noIAT   bool
+		want    []string // IDs of the returned keys
+		wantErr bool
+	}{
+		{name: "key selected by kid", keys: []PublicKey{current, ec}, kid: "ec", alg: "ES256", want: []string{"ec"}},
+		{name: "all active keys without kid", keys: []PublicKey{current, retired, ec}, alg: "RS256", want: []string{"current"}},
+		{name: "unknown kid", keys: []PublicKey{current}, kid: "other", alg: "RS256", wantErr: true},
+		{name: "unknown kid falls back to unnamed keys", keys: []PublicKey{current, unnamed}, kid: "other", alg: "RS256", want: []string{""}},
+		{name: "algorithm not allowed for the key", keys: []PublicKey{ec}, kid: "ec", alg: "RS256", wantErr: true},
+		{name: "algorithm confusion without kid", keys: []PublicKey{ec}, alg: "HS256", wantErr: true},
+		{name: "key outside its window", keys: []PublicKey{retired}, kid: "retired", alg: "RS256", wantErr: true},
+		{name: "token without iat and a key with a window", keys: []PublicKey{retired}, kid: "retired", alg: "RS256", noIAT: true, wantErr: true},
+		{name: "token without iat skips keys with a window", keys: []PublicKey{current, retired}, alg: "RS256", noIAT: true, want: []string{"current"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at := issued
+			if tt.noIAT {
+				at = time.Time{}
+			}
+			keys, err := NewKeyring(tt.keys).lookup(tt.kid, tt.alg, at)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("lookup returned %d keys, want an error", len(keys))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("lookup: %v", err)
+			}
+			if len(keys) != len(tt.want) {
+				t.Fatalf("lookup returned %d keys, want %v", len(keys), tt.want)
+			}
+			for i, id := range tt.want {
+				if keys[i].ID != id {
+					t.Errorf("key %d = %q, want %q", i, keys[i].ID, id)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyWithKeyring(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	rsaKey, _ := newPublicKey("rsa", &testKey().PublicKey, "")
+	ec, _ := newPublicKey("ec", &ecKey.PublicKey, "")
+
+	validator := newTestValidator(t)
+	validator.Keyring().Replace([]PublicKey{rsaKey, ec})
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, licenseClaimsAt(24*time.Hour))
+	token.Header["kid"] = "ec"
+	signed, err := token.SignedString(ecKey)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	if _, err := validator.Verify(signed); err != nil {
+		t.Errorf("ES256 license with kid ec rejected: %v", err)
+	}
+
+	token = jwt.NewWithClaims(jwt.SigningMethodRS256, licenseClaimsAt(24*time.Hour))
+	token.Header["kid"] = "ec"
+	signed, err = token.SignedString(testKey())
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	if _, err := validator.Verify(signed); err == nil {
+		t.Error("RS256 license naming the EC key accepted")
+	}
+}
+
+func TestVerifyKeyRotationOverlap(t *testing.T) {
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	// es-2025 was retired an hour ago, after a day of overlap with es-2026
+	retiredAt := time.Now().Add(-time.Hour)
+	oldKey, _ := newPublicKey("es-2025", &testKey().PublicKey, "")
+	oldKey.NotAfter = retiredAt
+	currentKey, _ := newPublicKey("es-2026", &newKey.PublicKey, "")
+	currentKey.NotBefore = retiredAt.Add(-24 * time.Hour)
+
+	validator := newTestValidator(t)
+	validator.Keyring().Replace([]PublicKey{oldKey, currentKey})
+
+	signWith := func(kid string, issuedAt *time.Time) string {
+		claims := licenseClaimsAt(24 * time.Hour)
+		delete(claims, "iat")
+		if issuedAt != nil {
+			claims["iat"] = issuedAt.Unix()
+		}
+		var method jwt.SigningMethod = jwt.SigningMethodRS256
+		var key interface{} = testKey()
+		if kid == "es-2026" {
+			method, key = jwt.SigningMethodES256, newKey
+		}
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return signed
+	}
+	at := func(offset time.Duration) *time.Time {
+		issued := retiredAt.Add(offset)
+		return &issued
+	}
+
+	tests := []struct {
+		name     string
+		kid      string
+		issuedAt *time.Time
+		wantErr  bool
+	}{
+		{name: "old key, issued before its retirement", kid: "es-2025", issuedAt: at(-48 * time.Hour)},
+		{name: "old key, issued during the overlap", kid: "es-2025", issuedAt: at(-time.Hour)},
+		{name: "new key, issued during the overlap", kid: "es-2026", issuedAt: at(-time.Hour)},
+		{name: "new key, issued after the old key retired", kid: "es-2026", issuedAt: at(30 * time.Minute)},
+		{name: "old key, issued after its retirement", kid: "es-2025", issuedAt: at(30 * time.Minute), wantErr: true},
+		{name: "new key, issued before its window", kid: "es-2026", issuedAt: at(-48 * time.Hour), wantErr: true},
+		{name: "old key, no iat", kid: "es-2025", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := validator.Verify(signWith(tt.kid, tt.issuedAt))
+			if tt.wantErr && err == nil {
+				t.Error("license accepted, want an error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("license rejected: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package license
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// RevocationList is a signed list of revoked licenses, identified by license
+// ID or by JWT ID. It is distributed as a JWT signed with the license key:
+//
+//	{"iat": 1735689600, "revocations": [{"license_id": "LIC-1", "reason": "leaked"}, {"jti": "a1b2"}]}
+type RevocationList struct {
+	IssuedAt    time.Time
+	Revocations []RevokedLicense
+}
+
+// RevokedLicense is a single revocation list entry. Either LicenseID or JTI
+// is set; a JTI revokes one issued token rather than the whole license.
+type RevokedLicense struct {
+	LicenseID string `json:"license_id,omitempty"`
+	JTI       string `json:"jti,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// ParseRevocationList verifies a revocation list JWT with the validator's
+// trusted keys and parses it
+func (v *Validator) ParseRevocationList(listJWT string) (*RevocationList, error) {
+	_, claims, err := v.verifyToken(listJWT)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := parseRevocationList(claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse revocation list: %w", err)
+	}
+	return list, nil
+}
+
+// SetRevocationList replaces the revocation list used by Validate. A list
+// issued before the current one is rejected, so an old list cannot be
+// replayed to un-revoke a license. Returns whether the list was applied.
+func (v *Validator) SetRevocationList(list *RevocationList) (bool, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.revocations != nil {
+		if list.IssuedAt.Before(v.revocations.IssuedAt) {
+			return false, fmt.Errorf("revocation list issued %s is older than the current one (%s)",
+				list.IssuedAt.Format(time.RFC3339), v.revocations.IssuedAt.Format(time.RFC3339))
+		}
+		if list.IssuedAt.Equal(v.revocations.IssuedAt) {
+			return false, nil
+		}
+	}
+	v.revocations = list
+	return true, nil
+}
+
+// RevocationList returns the revocation list in use, or nil if none is set
+func (v *Validator) RevocationList() *RevocationList {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.revocations
+}
+
+// reason reports whether the list revokes a license, and why
+func (l *RevocationList) reason(license *License) (string, bool) {
+	for _, revoked := range l.Revocations {
+		if revoked.LicenseID != "" && revoked.LicenseID == license.LicenseID {
+			return revoked.Reason, true
+		}
+		if revoked.JTI != "" && revoked.JTI == license.JTI {
+			return revoked.Reason, true
+		}
+	}
+	return "", false
+}
+
+// parseRevocationList parses revocation list claims
+func parseRevocationList(claims *jwt.MapClaims) (*RevocationList, error) {
+	iat, ok := (*claims)["iat"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("missing iat claim")
+	}
+	entries, ok := (*claims)["revocations"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("missing revocations claim")
+	}
+
+	list := &RevocationList{
+		IssuedAt:    time.Unix(int64(iat), 0),
+		Revocations: make([]RevokedLicense, 0, len(entries)),
+	}
+	for i, e := range entries {
+		entry, ok := e.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("revocations[%d] is not an object", i)
+		}
+
+		var revoked RevokedLicense
+		if licenseID, ok := entry["license_id"].(string); ok {
+			revoked.LicenseID = licenseID
+		}
+		if jti, ok := entry["jti"].(string); ok {
+			revoked.JTI = jti
+		}
+		if reason, ok := entry["reason"].(string); ok {
+			revoked.Reason = reason
+		}
+		if revoked.LicenseID == "" && revoked.JTI == "" {
+			return nil, fmt.Errorf("revocations[%d] has neither license_id nor jti", i)
+		}
+		list.Revocations = append(list.Revocations, revoked)
+	}
+	return list, nil
+}
@@ -0,0 +1,157 @@
+package license
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestParseRevocationList(t *testing.T) {
+	tests := []struct {
+		name    string
+		claims  jwt.MapClaims
+		want    []RevokedLicense
+		wantErr bool
+	}{
+		{
+			name: "license ID and JTI entries",
+			claims: jwt.MapClaims{
+				"iat": 1735689600,
+				"revocations": []interface{}{
+					map[string]interface{}{"license_id": "lic-1", "reason": "leaked"},
+					map[string]interface{}{"jti": "a1b2"},
+				},
+			},
+			want: []RevokedLicense{{LicenseID: "lic-1", Reason: "leaked"}, {JTI: "a1b2"}},
+		},
+		{
+			name:   "empty list",
+			claims: jwt.MapClaims{"iat": 1735689600, "revocations": []interface{}{}},
+			want:   []RevokedLicense{},
+		},
+		{
+			name:    "missing iat",
+			claims:  jwt.MapClaims{"revocations": []interface{}{}},
+			wantErr: true,
+		},
+		{
+			name:    "missing revocations",
+			claims:  jwt.MapClaims{"iat": 1735689600},
+			wantErr: true,
+		},
+		{
+			name: "entry without license_id or jti",
+			claims: jwt.MapClaims{
+				"iat":         1735689600,
+				"revocations": []interface{}{map[string]interface{}{"reason": "leaked"}},
+			},
+			wantErr: true,
+		},
+	}
+
+	validator := newTestValidator(t)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := validator.ParseRevocationList(sign(t, testKey(), tt.claims))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("ParseRevocationList succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRevocationList: %v", err)
+			}
+			if !list.IssuedAt.Equal(time.Unix(1735689600, 0)) {
+				t.Errorf("issued at = %s", list.IssuedAt)
+			}
+			if len(list.Revocations) != len(tt.want) {
+				t.Fatalf("revocations = %+v, want %+v", list.Revocations, tt.want)
+			}
+			for i, want := range tt.want {
+				if list.Revocations[i] != want {
+					t.Errorf("revocation %d = %+v, want %+v", i, list.Revocations[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRevocationListRejectsUntrustedSignature(t *testing.T) {
+	validator := newTestValidator(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	other, err := NewValidator(publicKeyPEM(t, otherKey))
+	if err != nil {
+		t.Fatalf("failed to create validator: %v", err)
+	}
+
+	listJWT := sign(t, testKey(), jwt.MapClaims{"iat": 1735689600, "revocations": []interface{}{}})
+	if _, err := other.ParseRevocationList(listJWT); err == nil {
+		t.Error("revocation list accepted without a trusted key")
+	}
+	if _, err := validator.ParseRevocationList(listJWT + "x"); err == nil {
+		t.Error("revocation list with a corrupted signature accepted")
+	}
+}
+
+func TestSetRevocationList(t *testing.T) {
+	validator := newTestValidator(t)
+	issued := time.Unix(1735689600, 0)
+
+	revoking := &RevocationList{IssuedAt: issued, Revocations: []RevokedLicense{{LicenseID: "lic-1", Reason: "leaked"}}}
+	if applied, err := validator.SetRevocationList(revoking); err != nil || !applied {
+		t.Fatalf("first list: applied = %v, err = %v", applied, err)
+	}
+
+	result := validate(validator, sign(t, testKey(), licenseClaimsAt(24*time.Hour)), 3)
+	if !result.Revoked || result.Valid || result.RevocationReason != "leaked" {
+		t.Errorf("revoked license: revoked = %v, valid = %v, reason = %q", result.Revoked, result.Valid, result.RevocationReason)
+	}
+
+	if applied, err := validator.SetRevocationList(&RevocationList{IssuedAt: issued}); err != nil || applied {
+		t.Errorf("list with the same issue time: applied = %v, err = %v", applied, err)
+	}
+	if _, err := validator.SetRevocationList(&RevocationList{IssuedAt: issued.Add(-time.Hour)}); err == nil {
+		t.Error("older list accepted, want an error")
+	}
+	if validator.RevocationList() != revoking {
+		t.Error("older list replaced the current one")
+	}
+
+	if applied, err := validator.SetRevocationList(&RevocationList{IssuedAt: issued.Add(time.Hour)}); err != nil || !applied {
+		t.Fatalf("newer list: applied = %v, err = %v", applied, err)
+	}
+	result = validate(validator, sign(t, testKey(), licenseClaimsAt(24*time.Hour)), 3)
+	if result.Revoked || !result.Valid {
+		t.Errorf("license still revoked after a newer list dropped it: %v", result.Error)
+	}
+}
+
+func TestRevocationByJTI(t *testing.T) {
+	validator := newTestValidator(t)
+	if _, err := validator.SetRevocationList(&RevocationList{
+		IssuedAt:    time.Unix(1735689600, 0),
+		Revocations: []RevokedLicense{{JTI: "token-1"}},
+	}); err != nil {
+		t.Fatalf("SetRevocationList: %v", err)
+	}
+
+	revoked := licenseClaimsAt(24 * time.Hour)
+	revoked["jti"] = "token-1"
+	if result := validate(validator, sign(t, testKey(), revoked), 3); !result.Revoked {
+		t.Error("token with a revoked jti not revoked")
+	}
+
+	reissued := licenseClaimsAt(24 * time.Hour)
+	reissued["jti"] = "token-2"
+	if result := validate(validator, sign(t, testKey(), reissued), 3); result.Revoked {
+		t.Error("reissued token of the same license revoked")
+	}
+}
@@ -1,10 +1,8 @@
 package license
 
 import (
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -15,9 +13,11 @@ type License struct {
 	// Standard JWT claims
 	Issuer     string    `json:"iss"`
 	Subject    string    `json:"sub"`
+	Audience   []string  `json:"aud"`
 	IssuedAt   time.Time `json:"iat"`
 	ExpiresAt  time.Time `json:"exp"`
 	NotBefore  time.Time `json:"nbf"`
+	JTI        string    `json:"jti"`
 
 	// Custom claims
 	LicenseID       string            `json:"license_id"`
@@ -35,13 +35,43 @@ type License struct {
 	NodeSelector    map[string]string `json:"node_selector"`
 	Features        []string          `json:"features"`
 	GracePeriodDays int               `json:"grace_period_days"`
-	WarningDays     int               `json:"warning_days"`
-	PhoneHomeConfig PhoneHomeConfig   `json:"phone_home"`
+
+	// Capacity limits; zero means not limited
+	LicensedVCPUs     float64 `json:"licensed_vcpus,omitempty"`
+	LicensedMemoryGiB float64 `json:"licensed_memory_gib,omitempty"`
+	LicensedGPUs      int     `json:"licensed_gpus,omitempty"`
+
+	WarningDays     int             `json:"warning_days"`
+	PhoneHomeConfig PhoneHomeConfig `json:"phone_home"`
+
+	// Products covered by the license. Flat single-product licenses are
+	// parsed into a one-element list built from the top-level claims.
+	Products []ProductLicense `json:"products"`
+}
+
+// ProductLicense holds the per-product entitlement from the license
+type ProductLicense struct {
+	ProductCode   string            `json:"product_code"`
+	ProductName   string            `json:"product_name"`
+	TierCode      string            `json:"tier_code"`
+	TierName      string            `json:"tier_name"`
+	LicensedNodes int               `json:"licensed_nodes"`
+	MaxNodes      int               `json:"max_nodes,omitempty"`
+	NodeSelector  map[string]string `json:"node_selector"`
+	Features      []string          `json:"features"`
+
+	// Capacity limits; zero means not limited. Licenses priced by capacity
+	// may omit licensed_nodes, leaving the node count unlimited.
+	NodesLimited      bool    `json:"-"`
+	LicensedVCPUs     float64 `json:"licensed_vcpus,omitempty"`
+	LicensedMemoryGiB float64 `json:"licensed_memory_gib,omitempty"`
+	LicensedGPUs      int     `json:"licensed_gpus,omitempty"`
 }
 
-// PhoneHomeConfig holds phone home configuration from the license
+// PhoneHomeConfig holds phone home configuration from the license. Unset
+// fields leave the validator's own configuration in effect.
 type PhoneHomeConfig struct {
-	Enabled       bool   `json:"enabled"`
+	Enabled       *bool  `json:"enabled"`
 	URL           string `json:"url"`
 	IntervalHours int    `json:"interval_hours"`
 }
@@ -54,79 +84,252 @@ type ValidationResult struct {
 	ExpiresAt        time.Time
 	DaysUntilExpiry  int
 	IsInGracePeriod  bool
+	ExpiringSoon     bool // within the license's warning_days of expiry
 	NodeCount        int
 	LicensedNodes    int
+	MaxNodes         int // hard node limits: max_nodes, or licensed_nodes for products without one
 	NodeCountValid   bool
+	CapacityValid    bool // every product within all its licensed dimensions, nodes included
+	Overage          bool // a product has more nodes than licensed_nodes but no more than max_nodes
+	OverageNodes     int  // nodes beyond licensed_nodes, billed as overage
 	NamespaceValid   bool
 	ActualNamespace  string
 	LicenseNamespace string
 	SignatureValid   bool
 	ExpiryValid      bool
+	NotBeforeValid   bool
+	KeyID            string // kid of the signing key, if the token named one
+	Algorithm        string // JWT signing algorithm, e.g. "RS256" or "EdDSA"
+	Revoked          bool
+	RevocationReason string
 	ValidationTime   time.Time
+
+	// Failures outside the license itself
+	NodeCountUnavailable bool // nodes could not be counted, e.g. API server unreachable
+	SecretUnreadable     bool // the license Secret could not be read, other than missing; set by the caller
+
+	// Distinct nodes outside the licensed selectors running ES product pods,
+	// if placement is audited
+	UnlicensedNodes int
+
+	// Per-product node count checks. NodeCount, LicensedNodes, MaxNodes and
+	// OverageNodes above are summed across products; NodeCountValid holds only
+	// if every product's does.
+	Products []ProductResult
+}
+
+// ProductResult represents the node count check for a single product
+type ProductResult struct {
+	ProductCode    string
+	ProductName    string
+	TierCode       string
+	NodeSelector   map[string]string
+	NodeCount      int
+	LicensedNodes  int
+	MaxNodes       int  // zero when licensed_nodes is the hard limit
+	NodeCountValid bool // within max_nodes, or licensed_nodes without one; true when neither is declared
+	Overage        bool // above licensed_nodes but within max_nodes: allowed, billed as overage
+	OverageNodes   int
+	Valid          bool
+
+	// Capacity of the matching nodes, and the check of each dimension the
+	// license limits (nodes, vcpus, memory_gib, gpus)
+	Capacity      Capacity
+	Dimensions    []DimensionResult
+	CapacityValid bool
+
+	// Where the product's pods run; nil when placement is not audited
+	Placement *PlacementAudit
+}
+
+// PlacementAudit reports pods of a product scheduled outside its licensed nodes
+type PlacementAudit struct {
+	Pods            int      // pods of the product scheduled on a node
+	UnlicensedPods  []string // "namespace/name" of pods on unlicensed nodes
+	UnlicensedNodes []string // unlicensed nodes running pods of the product
+}
+
+// PlacementFunc audits where a product's pods run against the product's node
+// selector. An empty selector means the validator's configured default label.
+type PlacementFunc func(productCode string, selector map[string]string) (PlacementAudit, error)
+
+// supportedAlgorithms are the JWT signing algorithms accepted for licenses
+var supportedAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "EdDSA"}
+
+// Clock provides the current time to the validator
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the local system clock
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
 }
 
 // Validator validates license JWTs
 type Validator struct {
-	publicKey *rsa.PublicKey
-}
+	keyring *Keyring
+	clock   Clock
+	leeway  time.Duration // clock skew tolerated on exp and nbf
 
-// NewValidator creates a new license validator with the given public key
-func NewValidator(publicKeyPEM string) (*Validator, error) {
-	block, _ := pem.Decode([]byte(publicKeyPEM))
-	if block == nil {
-		return nil, fmt.Errorf("failed to parse PEM block containing the public key")
-	}
+	// Grace period for licenses without a grace_period_days claim
+	defaultGracePeriodDays int
 
-	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse public key: %w", err)
-	}
+	// Audits where product pods run; nil disables the audit
+	placementAudit PlacementFunc
+
+	// Expected iss and aud claims; empty means not checked
+	issuer   string
+	audience string
+
+	mu          sync.RWMutex
+	revocations *RevocationList // signed revocation list, nil until one is set
+}
 
-	rsaPub, ok := pub.(*rsa.PublicKey)
-	if !ok {
-		return nil, fmt.Errorf("not an RSA public key")
+// NewValidator creates a new license validator trusting the given public
+// keys, either a PEM bundle or a JWKS document
+func NewValidator(publicKeys string) (*Validator, error) {
+	keys, err := ParseKeys([]byte(publicKeys))
+	if err != nil {
+		return nil, err
 	}
 
 	return &Validator{
-		publicKey: rsaPub,
+		keyring: NewKeyring(keys),
+		clock:   systemClock{},
 	}, nil
 }
 
-// Validate validates a license JWT and returns the validation result
-func (v *Validator) Validate(licenseJWT string, actualNodeCount int, actualNamespace string) *ValidationResult {
-	result := &ValidationResult{
-		ValidationTime:  time.Now(),
-		NodeCount:       actualNodeCount,
-		ActualNamespace: actualNamespace,
+// SetClock replaces the clock used for time checks, e.g. with a trusted time
+// source
+func (v *Validator) SetClock(clock Clock) {
+	v.clock = clock
+}
+
+// SetLeeway sets the clock skew tolerated when checking exp and nbf
+func (v *Validator) SetLeeway(leeway time.Duration) {
+	v.leeway = leeway
+}
+
+// SetDefaultGracePeriod sets the grace period, in days, for licenses that do
+// not set grace_period_days
+func (v *Validator) SetDefaultGracePeriod(days int) {
+	v.defaultGracePeriodDays = days
+}
+
+// SetPlacementAudit audits each product's pod placement during validation
+func (v *Validator) SetPlacementAudit(audit PlacementFunc) {
+	v.placementAudit = audit
+}
+
+// SetIssuer requires licenses to carry the given iss claim
+func (v *Validator) SetIssuer(issuer string) {
+	v.issuer = issuer
+}
+
+// SetAudience requires licenses to name the given audience in their aud claim
+func (v *Validator) SetAudience(audience string) {
+	v.audience = audience
+}
+
+// Keyring returns the validator's trusted keys, e.g. to reload them
+func (v *Validator) Keyring() *Keyring {
+	return v.keyring
+}
+
+// revocationReason reports whether the revocation list revokes a license,
+// and why
+func (v *Validator) revocationReason(license *License) (string, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if v.revocations != nil {
+		return v.revocations.reason(license)
 	}
+	return "", false
+}
 
-	// Parse and validate JWT
-	token, err := jwt.ParseWithClaims(licenseJWT, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// Verify signing method
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return v.publicKey, nil
-	})
+// Verify checks a license JWT's signature and parses it, without the
+// cluster-specific node count and namespace checks
+func (v *Validator) Verify(licenseJWT string) (*License, error) {
+	_, claims, err := v.verifyToken(licenseJWT)
+	if err != nil {
+		return nil, err
+	}
 
+	license, err := parseLicense(claims, v.issuer, v.audience)
 	if err != nil {
-		result.Error = fmt.Errorf("JWT validation failed: %w", err)
-		result.Valid = false
-		return result
+		return nil, fmt.Errorf("failed to parse license: %w", err)
 	}
+	return license, nil
+}
 
-	result.SignatureValid = token.Valid
+// verifyToken checks the JWT signature against the keyring and returns the
+// token and its claims
+func (v *Validator) verifyToken(licenseJWT string) (*jwt.Token, *jwt.MapClaims, error) {
+	token, err := jwt.ParseWithClaims(licenseJWT, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
+		// Select the key by kid, or try every active key for tokens without
+		// one. Keys only verify algorithms matching their type, and must
+		// have been in their window when the token was issued, so a license
+		// outlives the retirement of the key that signed it.
+		kid, _ := token.Header["kid"].(string)
+		var issuedAt time.Time
+		if iat, err := token.Claims.GetIssuedAt(); err == nil && iat != nil {
+			issuedAt = iat.Time
+		}
+		keys, err := v.keyring.lookup(kid, token.Method.Alg(), issuedAt)
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) == 1 {
+			return keys[0].Key, nil
+		}
+		set := jwt.VerificationKeySet{Keys: make([]jwt.VerificationKey, 0, len(keys))}
+		for _, key := range keys {
+			set.Keys = append(set.Keys, key.Key)
+		}
+		return set, nil
+	},
+		jwt.WithValidMethods(supportedAlgorithms),
+		// Time claims are checked by Validate so expired licenses reach the
+		// grace period check; the rest by the license schema
+		jwt.WithoutClaimsValidation(),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("JWT validation failed: %w", err)
+	}
 
-	// Extract claims
 	claims, ok := token.Claims.(*jwt.MapClaims)
 	if !ok || !token.Valid {
-		result.Error = fmt.Errorf("invalid JWT claims")
+		return nil, nil, fmt.Errorf("invalid JWT claims")
+	}
+	return token, claims, nil
+}
+
+// Validate validates a license JWT and returns the validation result. Nodes
+// are measured with the license's own node selector.
+func (v *Validator) Validate(licenseJWT string, measure CapacityFunc, actualNamespace string) *ValidationResult {
+	now := v.clock.Now()
+	result := &ValidationResult{
+		ValidationTime:  now,
+		ActualNamespace: actualNamespace,
+	}
+
+	// Parse and validate JWT
+	token, claims, err := v.verifyToken(licenseJWT)
+	if err != nil {
+		result.Error = err
 		result.Valid = false
 		return result
 	}
 
+	result.SignatureValid = true
+	result.KeyID, _ = token.Header["kid"].(string)
+	result.Algorithm = token.Method.Alg()
+
 	// Parse license from claims
-	license, err := parseLicense(claims)
+	license, err := parseLicense(claims, v.issuer, v.audience)
 	if err != nil {
 		result.Error = fmt.Errorf("failed to parse license: %w", err)
 		result.Valid = false
@@ -135,133 +338,133 @@ func (v *Validator) Validate(licenseJWT string, actualNodeCount int, actualNames
 
 	result.License = license
 	result.ExpiresAt = license.ExpiresAt
-	result.LicensedNodes = license.LicensedNodes
 	result.LicenseNamespace = license.Namespace
 
-	// Check expiration
-	now := time.Now()
+	// Check expiration, tolerating clock skew up to the leeway
+	expiresAt := license.ExpiresAt.Add(v.leeway)
 	result.DaysUntilExpiry = int(license.ExpiresAt.Sub(now).Hours() / 24)
-	result.ExpiryValid = now.Before(license.ExpiresAt)
+	result.ExpiryValid = now.Before(expiresAt)
 
 	// Check if in grace period
-	gracePeriodEnd := license.ExpiresAt.AddDate(0, 0, license.GracePeriodDays)
-	result.IsInGracePeriod = now.After(license.ExpiresAt) && now.Before(gracePeriodEnd)
+	gracePeriodDays := license.GracePeriodDays
+	if gracePeriodDays == 0 {
+		gracePeriodDays = v.defaultGracePeriodDays
+	}
+	gracePeriodEnd := expiresAt.AddDate(0, 0, gracePeriodDays)
+	result.IsInGracePeriod = !result.ExpiryValid && now.Before(gracePeriodEnd)
+
+	// Warn ahead of expiry
+	result.ExpiringSoon = result.ExpiryValid && license.WarningDays > 0 && result.DaysUntilExpiry <= license.WarningDays
+
+	// Check the license is already in effect
+	result.NotBeforeValid = license.NotBefore.IsZero() || !now.Add(v.leeway).Before(license.NotBefore)
+
+	// Check the node count and capacity of each product, using the product's
+	// node selector
+	result.NodeCountValid = true
+	result.CapacityValid = true
+	unlicensedNodes := make(map[string]struct{})
+	for _, product := range license.Products {
+		capacity, err := measure(product.NodeSelector)
+		if err != nil {
+			// Keep checking the rest of the license; the enforcement policy
+			// decides what an unknown node count means
+			result.Error = fmt.Errorf("failed to count nodes for product %s: %w", product.ProductCode, err)
+			result.NodeCountUnavailable = true
+		}
 
-	// Check node count
-	result.NodeCountValid = actualNodeCount <= license.LicensedNodes
+		productResult := ProductResult{
+			ProductCode:    product.ProductCode,
+			ProductName:    product.ProductName,
+			TierCode:       product.TierCode,
+			NodeSelector:   product.NodeSelector,
+			NodeCount:      capacity.Nodes,
+			LicensedNodes:  product.LicensedNodes,
+			MaxNodes:       product.MaxNodes,
+			NodeCountValid: err == nil,
+			Capacity:       capacity,
+			CapacityValid:  err == nil,
+		}
+		for _, limit := range product.Limits() {
+			dimension := limit.check(capacity.Value(limit.Dimension))
+			if err != nil {
+				dimension.Valid = false
+				dimension.Overage = false
+			}
+			productResult.Dimensions = append(productResult.Dimensions, dimension)
+			productResult.CapacityValid = productResult.CapacityValid && dimension.Valid
+			if limit.Dimension == DimensionNodes {
+				productResult.NodeCountValid = dimension.Valid
+				if dimension.Overage {
+					productResult.Overage = true
+					productResult.OverageNodes = capacity.Nodes - product.LicensedNodes
+				}
+			}
+		}
+		if v.placementAudit != nil && product.ProductCode != "" {
+			if audit, err := v.placementAudit(product.ProductCode, product.NodeSelector); err == nil {
+				productResult.Placement = &audit
+				for _, node := range audit.UnlicensedNodes {
+					unlicensedNodes[node] = struct{}{}
+				}
+			}
+		}
+		result.Products = append(result.Products, productResult)
+
+		result.NodeCount += capacity.Nodes
+		result.LicensedNodes += product.LicensedNodes
+		result.MaxNodes += max(product.MaxNodes, product.LicensedNodes)
+		result.OverageNodes += productResult.OverageNodes
+		result.Overage = result.Overage || productResult.Overage
+		result.NodeCountValid = result.NodeCountValid && productResult.NodeCountValid
+		result.CapacityValid = result.CapacityValid && productResult.CapacityValid
+	}
+	result.UnlicensedNodes = len(unlicensedNodes)
 
 	// Check namespace match
 	result.NamespaceValid = actualNamespace == license.Namespace
 
 	// Overall validity: signature must be valid, not expired (or in grace period),
-	// node count must be valid, AND namespace must match
-	result.Valid = result.SignatureValid && (result.ExpiryValid || result.IsInGracePeriod) && result.NodeCountValid && result.NamespaceValid
+	// node count and capacity must be within limits, AND namespace must match
+	result.Valid = result.SignatureValid && (result.ExpiryValid || result.IsInGracePeriod) && result.CapacityValid && result.NamespaceValid
 
 	if !result.NamespaceValid {
 		result.Error = fmt.Errorf("namespace mismatch: license is for namespace '%s' but validator is running in '%s'", license.Namespace, actualNamespace)
 		result.Valid = false
 	}
 
-	return result
-}
-
-// parseLicense parses license claims into a License struct
-func parseLicense(claims *jwt.MapClaims) (*License, error) {
-	license := &License{}
-
-	// Standard claims
-	if iss, ok := (*claims)["iss"].(string); ok {
-		license.Issuer = iss
-	}
-	if sub, ok := (*claims)["sub"].(string); ok {
-		license.Subject = sub
-	}
-	if iat, ok := (*claims)["iat"].(float64); ok {
-		license.IssuedAt = time.Unix(int64(iat), 0)
-	}
-	if exp, ok := (*claims)["exp"].(float64); ok {
-		license.ExpiresAt = time.Unix(int64(exp), 0)
-	}
-	if nbf, ok := (*claims)["nbf"].(float64); ok {
-		license.NotBefore = time.Unix(int64(nbf), 0)
-	}
-
-	// Custom claims
-	if licenseID, ok := (*claims)["license_id"].(string); ok {
-		license.LicenseID = licenseID
-	}
-	if customerID, ok := (*claims)["customer_id"].(string); ok {
-		license.CustomerID = customerID
-	}
-	if customerName, ok := (*claims)["customer_name"].(string); ok {
-		license.CustomerName = customerName
-	}
-	if productCode, ok := (*claims)["product_code"].(string); ok {
-		license.ProductCode = productCode
-	}
-	if productName, ok := (*claims)["product_name"].(string); ok {
-		license.ProductName = productName
-	}
-	if tierCode, ok := (*claims)["tier_code"].(string); ok {
-		license.TierCode = tierCode
-	}
-	if tierName, ok := (*claims)["tier_name"].(string); ok {
-		license.TierName = tierName
-	}
-	if clusterID, ok := (*claims)["cluster_id"].(string); ok {
-		license.ClusterID = clusterID
-	}
-	if clusterName, ok := (*claims)["cluster_name"].(string); ok {
-		license.ClusterName = clusterName
-	}
-	if namespace, ok := (*claims)["namespace"].(string); ok {
-		license.Namespace = namespace
-	}
-	if licensedNodes, ok := (*claims)["licensed_nodes"].(float64); ok {
-		license.LicensedNodes = int(licensedNodes)
-	}
-	if maxNodes, ok := (*claims)["max_nodes"].(float64); ok {
-		license.MaxNodes = int(maxNodes)
-	}
-	if gracePeriodDays, ok := (*claims)["grace_period_days"].(float64); ok {
-		license.GracePeriodDays = int(gracePeriodDays)
-	}
-	if warningDays, ok := (*claims)["warning_days"].(float64); ok {
-		license.WarningDays = int(warningDays)
+	if !result.NotBeforeValid {
+		result.Error = fmt.Errorf("license is not valid until %s", license.NotBefore.Format(time.RFC3339))
+		result.Valid = false
 	}
 
-	// Node selector
-	if nodeSelector, ok := (*claims)["node_selector"].(map[string]interface{}); ok {
-		license.NodeSelector = make(map[string]string)
-		for k, v := range nodeSelector {
-			if str, ok := v.(string); ok {
-				license.NodeSelector[k] = str
-			}
+	// Check revocation
+	if reason, revoked := v.revocationReason(license); revoked {
+		result.Revoked = true
+		result.RevocationReason = reason
+		if reason != "" {
+			result.Error = fmt.Errorf("license %s has been revoked: %s", license.LicenseID, reason)
+		} else {
+			result.Error = fmt.Errorf("license %s has been revoked", license.LicenseID)
 		}
+		result.Valid = false
 	}
 
-	// Features
-	if features, ok := (*claims)["features"].([]interface{}); ok {
-		license.Features = make([]string, 0, len(features))
-		for _, f := range features {
-			if str, ok := f.(string); ok {
-				license.Features = append(license.Features, str)
-			}
-		}
+	// A product is valid when the license-wide checks pass and its own capacity checks do
+	licenseValid := result.SignatureValid && (result.ExpiryValid || result.IsInGracePeriod) && result.NotBeforeValid && result.NamespaceValid && !result.Revoked
+	for i := range result.Products {
+		result.Products[i].Valid = licenseValid && result.Products[i].CapacityValid
 	}
 
-	// Phone home config
-	if phoneHome, ok := (*claims)["phone_home"].(map[string]interface{}); ok {
-		if enabled, ok := phoneHome["enabled"].(bool); ok {
-			license.PhoneHomeConfig.Enabled = enabled
-		}
-		if url, ok := phoneHome["url"].(string); ok {
-			license.PhoneHomeConfig.URL = url
-		}
-		if interval, ok := phoneHome["interval_hours"].(float64); ok {
-			license.PhoneHomeConfig.IntervalHours = int(interval)
+	return result
+}
+
+// Product returns the result for the given product code, if the license covers it
+func (r *ValidationResult) Product(productCode string) (*ProductResult, bool) {
+	for i := range r.Products {
+		if r.Products[i].ProductCode == productCode {
+			return &r.Products[i], true
 		}
 	}
-
-	return license, nil
+	return nil, false
 }
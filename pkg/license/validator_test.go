@@ -0,0 +1,253 @@
+package license
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testKey is the key signing test licenses, generated once per test run
+var testKey = sync.OnceValue(func() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+})
+
+// publicKeyPEM encodes the public half of key as a PEM block
+func publicKeyPEM(t *testing.T, key *rsa.PrivateKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// newTestValidator returns a validator trusting testKey
+func newTestValidator(t *testing.T) *Validator {
+	t.Helper()
+	validator, err := NewValidator(publicKeyPEM(t, testKey()))
+	if err != nil {
+		t.Fatalf("failed to create validator: %v", err)
+	}
+	return validator
+}
+
+// sign signs claims with key as an RS256 JWT
+func sign(t *testing.T, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return token
+}
+
+// licenseClaimsAt returns the claims of a valid license for namespace es-core
+// expiring in expiresIn
+func licenseClaimsAt(expiresIn time.Duration) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(expiresIn).Unix(),
+		"license_id":     "lic-1",
+		"namespace":      "es-core",
+		"product_code":   "es-core-gw",
+		"licensed_nodes": 3,
+	}
+}
+
+// validate validates token against a cluster of nodes licensed nodes
+func validate(v *Validator, token string, nodes int) *ValidationResult {
+	return v.Validate(token, func(map[string]string) (Capacity, error) {
+		return Capacity{Nodes: nodes}, nil
+	}, "es-core")
+}
+
+func TestValidate(t *testing.T) {
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		claims    func() jwt.MapClaims
+		key       *rsa.PrivateKey
+		namespace string
+		valid     bool
+		signature bool
+		grace     bool
+		notBefore bool
+	}{
+		{
+			name:      "valid",
+			claims:    func() jwt.MapClaims { return licenseClaimsAt(24 * time.Hour) },
+			valid:     true,
+			signature: true,
+			notBefore: true,
+		},
+		{
+			name:      "signed by an untrusted key",
+			claims:    func() jwt.MapClaims { return licenseClaimsAt(24 * time.Hour) },
+			key:       other,
+			valid:     false,
+			signature: false,
+		},
+		{
+			name:      "expired",
+			claims:    func() jwt.MapClaims { return licenseClaimsAt(-48 * time.Hour) },
+			valid:     false,
+			signature: true,
+			notBefore: true,
+		},
+		{
+			name: "expired within its grace period",
+			claims: func() jwt.MapClaims {
+				claims := licenseClaimsAt(-48 * time.Hour)
+				claims["grace_period_days"] = 7
+				return claims
+			},
+			valid:     true,
+			signature: true,
+			grace:     true,
+			notBefore: true,
+		},
+		{
+			name: "expired within the leeway",
+			claims: func() jwt.MapClaims {
+				return licenseClaimsAt(-time.Minute)
+			},
+			valid:     true,
+			signature: true,
+			notBefore: true,
+		},
+		{
+			name: "not yet valid",
+			claims: func() jwt.MapClaims {
+				claims := licenseClaimsAt(24 * time.Hour)
+				claims["nbf"] = time.Now().Add(time.Hour).Unix()
+				return claims
+			},
+			valid:     false,
+			signature: true,
+			notBefore: false,
+		},
+		{
+			name: "not before within the leeway",
+			claims: func() jwt.MapClaims {
+				claims := licenseClaimsAt(24 * time.Hour)
+				claims["nbf"] = time.Now().Add(time.Minute).Unix()
+				return claims
+			},
+			valid:     true,
+			signature: true,
+			notBefore: true,
+		},
+		{
+			name:      "namespace mismatch",
+			claims:    func() jwt.MapClaims { return licenseClaimsAt(24 * time.Hour) },
+			namespace: "default",
+			valid:     false,
+			signature: true,
+			notBefore: true,
+		},
+	}
+
+	validator := newTestValidator(t)
+	validator.SetLeeway(5 * time.Minute)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := tt.key
+			if key == nil {
+				key = testKey()
+			}
+			namespace := tt.namespace
+			if namespace == "" {
+				namespace = "es-core"
+			}
+
+			result := validator.Validate(sign(t, key, tt.claims()), func(map[string]string) (Capacity, error) {
+				return Capacity{Nodes: 3}, nil
+			}, namespace)
+
+			if result.Valid != tt.valid {
+				t.Errorf("valid = %v, want %v (%v)", result.Valid, tt.valid, result.Error)
+			}
+			if result.SignatureValid != tt.signature {
+				t.Errorf("signature valid = %v, want %v (%v)", result.SignatureValid, tt.signature, result.Error)
+			}
+			if result.IsInGracePeriod != tt.grace {
+				t.Errorf("in grace period = %v, want %v", result.IsInGracePeriod, tt.grace)
+			}
+			if tt.signature && result.NotBeforeValid != tt.notBefore {
+				t.Errorf("not before valid = %v, want %v", result.NotBeforeValid, tt.notBefore)
+			}
+		})
+	}
+}
+
+func TestValidateNodeLimits(t *testing.T) {
+	tests := []struct {
+		name          string
+		licensedNodes int
+		maxNodes      int
+		nodes         int
+		valid         bool
+		overage       bool
+		overageNodes  int
+	}{
+		{name: "below licensed_nodes", licensedNodes: 3, maxNodes: 5, nodes: 2, valid: true},
+		{name: "at licensed_nodes", licensedNodes: 3, maxNodes: 5, nodes: 3, valid: true},
+		{name: "between licensed_nodes and max_nodes", licensedNodes: 3, maxNodes: 5, nodes: 4, valid: true, overage: true, overageNodes: 1},
+		{name: "at max_nodes", licensedNodes: 3, maxNodes: 5, nodes: 5, valid: true, overage: true, overageNodes: 2},
+		{name: "above max_nodes", licensedNodes: 3, maxNodes: 5, nodes: 6, valid: false},
+		{name: "at licensed_nodes without max_nodes", licensedNodes: 3, nodes: 3, valid: true},
+		{name: "above licensed_nodes without max_nodes", licensedNodes: 3, nodes: 4, valid: false},
+	}
+
+	validator := newTestValidator(t)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := licenseClaimsAt(24 * time.Hour)
+			claims["licensed_nodes"] = tt.licensedNodes
+			if tt.maxNodes > 0 {
+				claims["max_nodes"] = tt.maxNodes
+			}
+
+			result := validate(validator, sign(t, testKey(), claims), tt.nodes)
+			if !result.SignatureValid {
+				t.Fatalf("signature rejected: %v", result.Error)
+			}
+
+			product, ok := result.Product("es-core-gw")
+			if !ok {
+				t.Fatal("product es-core-gw missing from result")
+			}
+			if product.Valid != tt.valid || result.Valid != tt.valid {
+				t.Errorf("valid = %v (license %v), want %v", product.Valid, result.Valid, tt.valid)
+			}
+			if product.NodeCountValid != tt.valid {
+				t.Errorf("node count valid = %v, want %v", product.NodeCountValid, tt.valid)
+			}
+			if product.Overage != tt.overage || result.Overage != tt.overage {
+				t.Errorf("overage = %v (license %v), want %v", product.Overage, result.Overage, tt.overage)
+			}
+			if product.OverageNodes != tt.overageNodes || result.OverageNodes != tt.overageNodes {
+				t.Errorf("overage nodes = %d (license %d), want %d", product.OverageNodes, result.OverageNodes, tt.overageNodes)
+			}
+			if want := max(tt.maxNodes, tt.licensedNodes); result.MaxNodes != want {
+				t.Errorf("max nodes = %d, want %d", result.MaxNodes, want)
+			}
+		})
+	}
+}
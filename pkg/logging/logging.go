@@ -0,0 +1,38 @@
+package logging
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// New creates a structured logger writing to w. format is "json" or "text";
+// level is one of debug, info, warn or error. Unknown values fall back to
+// JSON at info level.
+func New(w io.Writer, level, format string) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level: parseLevel(level),
+	}
+
+	var handler slog.Handler
+	if strings.EqualFold(format, "text") {
+		handler = slog.NewTextHandler(w, opts)
+	} else {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+
+	return slog.New(handler)
+}
+
+func parseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
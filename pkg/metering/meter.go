@@ -0,0 +1,215 @@
+package metering
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// dateLayout is the layout of DailyUsage dates (UTC days)
+const dateLayout = "2006-01-02"
+
+// DailyUsage aggregates a product's node usage over one UTC day
+type DailyUsage struct {
+	Date          string  `json:"date"`           // YYYY-MM-DD, UTC
+	NodeHours     float64 `json:"node_hours"`     // node count integrated over time
+	PeakNodes     int     `json:"peak_nodes"`     // highest node count seen
+	AverageNodes  float64 `json:"average_nodes"`  // node hours per observed hour
+	ObservedHours float64 `json:"observed_hours"` // hours covered by samples
+}
+
+// ProductUsage is the metered usage of a single product
+type ProductUsage struct {
+	ProductCode   string       `json:"product_code"`
+	NodeHours     float64      `json:"node_hours"` // total over the retained days
+	PeakNodes     int          `json:"peak_nodes"` // highest over the retained days
+	LastNodeCount int          `json:"last_node_count"`
+	LastSampleAt  time.Time    `json:"last_sample_at"`
+	Days          []DailyUsage `json:"days"` // oldest first
+}
+
+// Store persists the meter's state
+type Store interface {
+	// Load returns the saved state, or nil if nothing was saved yet
+	Load(ctx context.Context) ([]byte, error)
+	Save(ctx context.Context, data []byte) error
+}
+
+// Meter integrates node counts over time into node-hours and daily peak and
+// average node counts per product. Node counts are step functions: a sample
+// holds until the next one. Gaps longer than maxGap, such as validator
+// downtime, are not integrated.
+type Meter struct {
+	store         Store
+	maxGap        time.Duration
+	retentionDays int
+
+	mu       sync.Mutex
+	products map[string]*ProductUsage
+}
+
+// NewMeter creates a meter persisting to store and keeping retentionDays days
+// of aggregates
+func NewMeter(store Store, maxGap time.Duration, retentionDays int) *Meter {
+	if retentionDays < 1 {
+		retentionDays = 1
+	}
+	return &Meter{
+		store:         store,
+		maxGap:        maxGap,
+		retentionDays: retentionDays,
+		products:      make(map[string]*ProductUsage),
+	}
+}
+
+// Load restores the state saved by an earlier run
+func (m *Meter) Load(ctx context.Context) error {
+	data, err := m.store.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load usage: %w", err)
+	}
+	if data == nil {
+		return nil
+	}
+
+	var products map[string]*ProductUsage
+	if err := json.Unmarshal(data, &products); err != nil {
+		return fmt.Errorf("failed to parse usage: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.products = products
+	if m.products == nil {
+		m.products = make(map[string]*ProductUsage)
+	}
+	return nil
+}
+
+// Record adds a node count sample per product, keyed by product code, and
+// persists the result
+func (m *Meter) Record(ctx context.Context, at time.Time, nodeCounts map[string]int) error {
+	m.mu.Lock()
+	for productCode, nodeCount := range nodeCounts {
+		usage, ok := m.products[productCode]
+		if !ok {
+			usage = &ProductUsage{ProductCode: productCode}
+			m.products[productCode] = usage
+		}
+		m.integrate(usage, nodeCount, at.UTC())
+	}
+	data, err := json.Marshal(m.products)
+	m.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("failed to encode usage: %w", err)
+	}
+	if err := m.store.Save(ctx, data); err != nil {
+		return fmt.Errorf("failed to save usage: %w", err)
+	}
+	return nil
+}
+
+// integrate accounts for the previous sample up to at, then starts a new one
+func (m *Meter) integrate(usage *ProductUsage, nodeCount int, at time.Time) {
+	last := usage.LastSampleAt
+	if !last.IsZero() && at.After(last) && at.Sub(last) <= m.maxGap {
+		// Split the interval at UTC midnights so each day gets its share
+		for start := last; start.Before(at); {
+			day := start.Truncate(24 * time.Hour)
+			end := day.Add(24 * time.Hour)
+			if end.After(at) {
+				end = at
+			}
+			daily := dailyUsage(usage, day.Format(dateLayout))
+			hours := end.Sub(start).Hours()
+			daily.NodeHours += float64(usage.LastNodeCount) * hours
+			daily.ObservedHours += hours
+			daily.PeakNodes = max(daily.PeakNodes, usage.LastNodeCount)
+			start = end
+		}
+	}
+
+	daily := dailyUsage(usage, at.Format(dateLayout))
+	daily.PeakNodes = max(daily.PeakNodes, nodeCount)
+
+	usage.LastNodeCount = nodeCount
+	usage.LastSampleAt = at
+	m.prune(usage, at)
+	summarize(usage)
+}
+
+// prune drops days older than the retention period
+func (m *Meter) prune(usage *ProductUsage, now time.Time) {
+	oldest := now.AddDate(0, 0, -(m.retentionDays - 1)).Format(dateLayout)
+	kept := usage.Days[:0]
+	for _, day := range usage.Days {
+		if day.Date >= oldest {
+			kept = append(kept, day)
+		}
+	}
+	usage.Days = kept
+}
+
+// summarize recomputes averages and totals from the daily aggregates
+func summarize(usage *ProductUsage) {
+	usage.NodeHours = 0
+	usage.PeakNodes = 0
+	for i := range usage.Days {
+		day := &usage.Days[i]
+		if day.ObservedHours > 0 {
+			day.AverageNodes = day.NodeHours / day.ObservedHours
+		}
+		usage.NodeHours += day.NodeHours
+		usage.PeakNodes = max(usage.PeakNodes, day.PeakNodes)
+	}
+}
+
+// dailyUsage returns the aggregate for date, adding it in date order if missing
+func dailyUsage(usage *ProductUsage, date string) *DailyUsage {
+	i := sort.Search(len(usage.Days), func(i int) bool {
+		return usage.Days[i].Date >= date
+	})
+	if i == len(usage.Days) || usage.Days[i].Date != date {
+		usage.Days = append(usage.Days, DailyUsage{})
+		copy(usage.Days[i+1:], usage.Days[i:])
+		usage.Days[i] = DailyUsage{Date: date}
+	}
+	return &usage.Days[i]
+}
+
+// Usage returns the metered usage of a product
+func (m *Meter) Usage(productCode string) (ProductUsage, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage, ok := m.products[productCode]
+	if !ok {
+		return ProductUsage{}, false
+	}
+	return copyUsage(usage), true
+}
+
+// All returns the metered usage of every product, sorted by product code
+func (m *Meter) All() []ProductUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	all := make([]ProductUsage, 0, len(m.products))
+	for _, usage := range m.products {
+		all = append(all, copyUsage(usage))
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].ProductCode < all[j].ProductCode
+	})
+	return all
+}
+
+func copyUsage(usage *ProductUsage) ProductUsage {
+	c := *usage
+	c.Days = append([]DailyUsage{}, usage.Days...)
+	return c
+}
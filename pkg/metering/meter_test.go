@@ -0,0 +1,146 @@
+package metering
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// memoryStore keeps the meter's state in memory
+type memoryStore struct {
+	data []byte
+}
+
+func (s *memoryStore) Load(context.Context) ([]byte, error) {
+	return s.data, nil
+}
+
+func (s *memoryStore) Save(_ context.Context, data []byte) error {
+	s.data = data
+	return nil
+}
+
+func TestMeterSplitsAtMidnight(t *testing.T) {
+	type sample struct {
+		at    string // RFC 3339
+		nodes int
+	}
+	tests := []struct {
+		name    string
+		maxGap  time.Duration
+		samples []sample
+		want    []DailyUsage // AverageNodes is checked as NodeHours / ObservedHours
+	}{
+		{
+			name:   "within a day",
+			maxGap: 6 * time.Hour,
+			samples: []sample{
+				{"2025-10-21T10:00:00Z", 3},
+				{"2025-10-21T12:00:00Z", 5},
+			},
+			want: []DailyUsage{
+				{Date: "2025-10-21", NodeHours: 6, ObservedHours: 2, PeakNodes: 5},
+			},
+		},
+		{
+			name:   "across midnight",
+			maxGap: 6 * time.Hour,
+			samples: []sample{
+				{"2025-10-21T22:00:00Z", 4},
+				{"2025-10-22T02:00:00Z", 1},
+			},
+			want: []DailyUsage{
+				{Date: "2025-10-21", NodeHours: 8, ObservedHours: 2, PeakNodes: 4},
+				{Date: "2025-10-22", NodeHours: 8, ObservedHours: 2, PeakNodes: 4},
+			},
+		},
+		{
+			name:   "ending exactly at midnight",
+			maxGap: 6 * time.Hour,
+			samples: []sample{
+				{"2025-10-21T23:00:00Z", 2},
+				{"2025-10-22T00:00:00Z", 7},
+			},
+			want: []DailyUsage{
+				{Date: "2025-10-21", NodeHours: 2, ObservedHours: 1, PeakNodes: 2},
+				{Date: "2025-10-22", NodeHours: 0, ObservedHours: 0, PeakNodes: 7},
+			},
+		},
+		{
+			name:   "across several midnights",
+			maxGap: 72 * time.Hour,
+			samples: []sample{
+				{"2025-10-21T12:00:00Z", 2},
+				{"2025-10-23T12:00:00Z", 2},
+			},
+			want: []DailyUsage{
+				{Date: "2025-10-21", NodeHours: 24, ObservedHours: 12, PeakNodes: 2},
+				{Date: "2025-10-22", NodeHours: 48, ObservedHours: 24, PeakNodes: 2},
+				{Date: "2025-10-23", NodeHours: 24, ObservedHours: 12, PeakNodes: 2},
+			},
+		},
+		{
+			name:   "UTC midnight, not local midnight",
+			maxGap: 6 * time.Hour,
+			samples: []sample{
+				{"2025-10-22T00:00:00+02:00", 3}, // 22:00 UTC the day before
+				{"2025-10-22T03:00:00+02:00", 3}, // 01:00 UTC
+			},
+			want: []DailyUsage{
+				{Date: "2025-10-21", NodeHours: 6, ObservedHours: 2, PeakNodes: 3},
+				{Date: "2025-10-22", NodeHours: 3, ObservedHours: 1, PeakNodes: 3},
+			},
+		},
+		{
+			name:   "gap longer than max gap across midnight",
+			maxGap: 6 * time.Hour,
+			samples: []sample{
+				{"2025-10-21T20:00:00Z", 4},
+				{"2025-10-22T04:00:00Z", 2},
+			},
+			want: []DailyUsage{
+				{Date: "2025-10-21", NodeHours: 0, ObservedHours: 0, PeakNodes: 4},
+				{Date: "2025-10-22", NodeHours: 0, ObservedHours: 0, PeakNodes: 2},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meter := NewMeter(&memoryStore{}, tt.maxGap, 90)
+			for _, s := range tt.samples {
+				at, err := time.Parse(time.RFC3339, s.at)
+				if err != nil {
+					t.Fatalf("invalid sample time %q: %v", s.at, err)
+				}
+				if err := meter.Record(context.Background(), at, map[string]int{"es-core-gw": s.nodes}); err != nil {
+					t.Fatalf("failed to record sample: %v", err)
+				}
+			}
+
+			usage, ok := meter.Usage("es-core-gw")
+			if !ok {
+				t.Fatal("no usage recorded")
+			}
+			if len(usage.Days) != len(tt.want) {
+				t.Fatalf("days = %+v, want %+v", usage.Days, tt.want)
+			}
+
+			var totalHours float64
+			for i, want := range tt.want {
+				got := usage.Days[i]
+				if got.Date != want.Date || got.NodeHours != want.NodeHours ||
+					got.ObservedHours != want.ObservedHours || got.PeakNodes != want.PeakNodes {
+					t.Errorf("day %d = %+v, want %+v", i, got, want)
+				}
+				if want.ObservedHours > 0 && got.AverageNodes != want.NodeHours/want.ObservedHours {
+					t.Errorf("day %d average nodes = %g, want %g", i, got.AverageNodes, want.NodeHours/want.ObservedHours)
+				}
+				totalHours += want.NodeHours
+			}
+			if usage.NodeHours != totalHours {
+				t.Errorf("total node hours = %g, want %g", usage.NodeHours, totalHours)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/enterprisesight/es-license-validator/pkg/license"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "es_license"
+
+// licenseLabels are attached to every license metric
+var licenseLabels = []string{"license_id", "product_code", "tier_code"}
+
+// Recorder exposes validation and phone home results as Prometheus metrics
+type Recorder struct {
+	registry *prometheus.Registry
+
+	licensedNodes    *prometheus.GaugeVec
+	maxNodes         *prometheus.GaugeVec
+	overageNodes     *prometheus.GaugeVec
+	nodeCount        *prometheus.GaugeVec
+	daysUntilExpiry  *prometheus.GaugeVec
+	inGracePeriod    *prometheus.GaugeVec
+	valid            *prometheus.GaugeVec
+	checkValid       *prometheus.GaugeVec
+	capacityUsed     *prometheus.GaugeVec
+	capacityLicensed *prometheus.GaugeVec
+
+	validationRuns    *prometheus.CounterVec
+	phoneHomeAttempts *prometheus.CounterVec
+	phoneHomeSuccess  *prometheus.CounterVec
+	phoneHomeFailures *prometheus.CounterVec
+	phoneHomeLatency  *prometheus.HistogramVec
+}
+
+// NewRecorder creates a new metrics recorder with its own registry
+func NewRecorder() *Recorder {
+	r := &Recorder{
+		registry: prometheus.NewRegistry(),
+
+		licensedNodes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "licensed_nodes",
+			Help:      "Number of nodes allowed by the license.",
+		}, licenseLabels),
+		maxNodes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "max_nodes",
+			Help:      "Hard node limit: max_nodes, or licensed_nodes when the license has none.",
+		}, licenseLabels),
+		overageNodes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "overage_nodes",
+			Help:      "Nodes beyond licensed_nodes but within max_nodes, billed as overage.",
+		}, licenseLabels),
+		nodeCount: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "node_count",
+			Help:      "Number of nodes matching the license's node selector.",
+		}, licenseLabels),
+		daysUntilExpiry: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "days_until_expiry",
+			Help:      "Days until the license expires (negative once expired).",
+		}, licenseLabels),
+		inGracePeriod: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "in_grace_period",
+			Help:      "1 if the license is expired but within its grace period.",
+		}, licenseLabels),
+		valid: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "valid",
+			Help:      "1 if the license passed validation.",
+		}, licenseLabels),
+		checkValid: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "check_valid",
+			Help:      "1 if the individual validation check passed.",
+		}, append([]string{"check"}, licenseLabels...)),
+		capacityUsed: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "capacity_used",
+			Help:      "Capacity of the licensed nodes in each dimension the license limits.",
+		}, append([]string{"dimension"}, licenseLabels...)),
+		capacityLicensed: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "capacity_licensed",
+			Help:      "Capacity allowed by the license in each dimension it limits.",
+		}, append([]string{"dimension"}, licenseLabels...)),
+
+		validationRuns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "validation_runs_total",
+			Help:      "Number of license validations performed.",
+		}, licenseLabels),
+		phoneHomeAttempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "phone_home_attempts_total",
+			Help:      "Number of phone home reports attempted.",
+		}, licenseLabels),
+		phoneHomeSuccess: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "phone_home_success_total",
+			Help:      "Number of phone home reports accepted by the license server.",
+		}, licenseLabels),
+		phoneHomeFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "phone_home_failures_total",
+			Help:      "Number of phone home reports that failed after all retries.",
+		}, licenseLabels),
+		phoneHomeLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "phone_home_duration_seconds",
+			Help:      "Time taken to phone home, including retries.",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+		}, licenseLabels),
+	}
+
+	r.registry.MustRegister(
+		r.licensedNodes,
+		r.maxNodes,
+		r.overageNodes,
+		r.nodeCount,
+		r.daysUntilExpiry,
+		r.inGracePeriod,
+		r.valid,
+		r.checkValid,
+		r.capacityUsed,
+		r.capacityLicensed,
+		r.validationRuns,
+		r.phoneHomeAttempts,
+		r.phoneHomeSuccess,
+		r.phoneHomeFailures,
+		r.phoneHomeLatency,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return r
+}
+
+// Handler returns the HTTP handler serving /metrics
+func (r *Recorder) Handler() http.Handler {
+	return promhttp.HandlerFor(r.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveResults replaces the license gauges with the given validation
+// results, so removed licenses stop being reported
+func (r *Recorder) ObserveResults(results []*license.ValidationResult) {
+	for _, gauge := range []*prometheus.GaugeVec{r.licensedNodes, r.maxNodes, r.overageNodes, r.nodeCount, r.daysUntilExpiry, r.inGracePeriod, r.valid, r.checkValid, r.capacityUsed, r.capacityLicensed} {
+		gauge.Reset()
+	}
+
+	for _, result := range results {
+		if result.License == nil {
+			r.validationRuns.WithLabelValues("", "", "").Inc()
+			continue
+		}
+
+		// One series per product covered by the license
+		for _, product := range result.Products {
+			labels := prometheus.Labels{
+				"license_id":   result.License.LicenseID,
+				"product_code": product.ProductCode,
+				"tier_code":    product.TierCode,
+			}
+
+			r.validationRuns.With(labels).Inc()
+			r.licensedNodes.With(labels).Set(float64(product.LicensedNodes))
+			r.maxNodes.With(labels).Set(float64(max(product.MaxNodes, product.LicensedNodes)))
+			r.overageNodes.With(labels).Set(float64(product.OverageNodes))
+			r.nodeCount.With(labels).Set(float64(product.NodeCount))
+			r.daysUntilExpiry.With(labels).Set(float64(result.DaysUntilExpiry))
+			r.inGracePeriod.With(labels).Set(boolToFloat(result.IsInGracePeriod))
+			r.valid.With(labels).Set(boolToFloat(product.Valid))
+
+			checks := map[string]bool{
+				"signature":  result.SignatureValid,
+				"expiry":     result.ExpiryValid,
+				"not_before": result.NotBeforeValid,
+				"node_count": product.NodeCountValid,
+				"capacity":   product.CapacityValid,
+				"namespace":  result.NamespaceValid,
+			}
+			for check, ok := range checks {
+				r.checkValid.With(withLabel(labels, "check", check)).Set(boolToFloat(ok))
+			}
+
+			for _, dimension := range product.Dimensions {
+				dimensionLabels := withLabel(labels, "dimension", dimension.Dimension)
+				r.capacityUsed.With(dimensionLabels).Set(dimension.Used)
+				r.capacityLicensed.With(dimensionLabels).Set(dimension.Licensed)
+			}
+		}
+	}
+}
+
+// ObservePhoneHome records the outcome and latency of a phone home report
+func (r *Recorder) ObservePhoneHome(lic *license.License, duration time.Duration, err error) {
+	labels := prometheus.Labels{
+		"license_id":   lic.LicenseID,
+		"product_code": lic.ProductCode,
+		"tier_code":    lic.TierCode,
+	}
+
+	r.phoneHomeAttempts.With(labels).Inc()
+	r.phoneHomeLatency.With(labels).Observe(duration.Seconds())
+	if err != nil {
+		r.phoneHomeFailures.With(labels).Inc()
+	} else {
+		r.phoneHomeSuccess.With(labels).Inc()
+	}
+}
+
+func withLabel(labels prometheus.Labels, name, value string) prometheus.Labels {
+	out := prometheus.Labels{name: value}
+	for k, v := range labels {
+		out[k] = v
+	}
+	return out
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
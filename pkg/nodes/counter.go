@@ -3,21 +3,52 @@ package nodes
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"sync"
+	"time"
 
+	"github.com/enterprisesight/es-license-validator/pkg/license"
+
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
+	listersv1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 )
 
-// Counter counts Kubernetes nodes matching a label selector
+// Counter counts Kubernetes nodes matching a label selector. Nodes are served
+// from a shared informer cache instead of listing them on every count.
 type Counter struct {
 	clientset      *kubernetes.Clientset
 	nodeLabelKey   string
 	nodeLabelValue string
+	informer       cache.SharedIndexInformer
+	lister         listersv1.NodeLister
+	gpuResources   []corev1.ResourceName
+
+	// Health of the node watch. The cache keeps serving the last known nodes
+	// while the API server is unreachable, so failed list and watch calls
+	// are tracked to tell when counts are stale.
+	mu           sync.Mutex
+	failingSince time.Time
+	lastError    error
 }
 
-// NewCounter creates a new node counter
-func NewCounter(nodeLabelKey, nodeLabelValue string) (*Counter, error) {
+// defaultGPUResources are the extended resources counted as GPUs
+var defaultGPUResources = []corev1.ResourceName{"nvidia.com/gpu", "amd.com/gpu"}
+
+// watchFailureTolerance is how long the node watch may keep failing before
+// counts are reported as unavailable, riding out brief API server blips
+const watchFailureTolerance = time.Minute
+
+// NewCounter creates a new node counter. If watchSelector is non-empty, only
+// nodes matching it are cached; license node selectors outside of it will
+// never match.
+func NewCounter(nodeLabelKey, nodeLabelValue, watchSelector string) (*Counter, error) {
 	// Create in-cluster config
 	config, err := rest.InClusterConfig()
 	if err != nil {
@@ -30,25 +61,197 @@ func NewCounter(nodeLabelKey, nodeLabelValue string) (*Counter, error) {
 		return nil, fmt.Errorf("failed to create kubernetes clientset: %w", err)
 	}
 
-	return &Counter{
+	if _, err := labels.Parse(watchSelector); err != nil {
+		return nil, fmt.Errorf("invalid node watch selector %q: %w", watchSelector, err)
+	}
+
+	c := &Counter{
 		clientset:      clientset,
 		nodeLabelKey:   nodeLabelKey,
 		nodeLabelValue: nodeLabelValue,
-	}, nil
+		gpuResources:   defaultGPUResources,
+	}
+
+	// Create node informer, optionally filtered by label selector, recording
+	// the outcome of every list and watch call
+	nodes := clientset.CoreV1().Nodes()
+	c.informer = cache.NewSharedIndexInformer(&cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			opts.LabelSelector = watchSelector
+			list, err := nodes.List(context.Background(), opts)
+			c.observe(err)
+			return list, err
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			opts.LabelSelector = watchSelector
+			w, err := nodes.Watch(context.Background(), opts)
+			c.observe(err)
+			return w, err
+		},
+	}, &corev1.Node{}, 0, cache.Indexers{})
+	if err := c.informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+		cache.DefaultWatchErrorHandler(r, err)
+		c.observe(err)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to set node watch error handler: %w", err)
+	}
+	c.lister = listersv1.NewNodeLister(c.informer.GetIndexer())
+
+	return c, nil
+}
+
+// observe records the outcome of a node list or watch call
+func (c *Counter) observe(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err == nil {
+		c.failingSince = time.Time{}
+		c.lastError = nil
+		return
+	}
+	if c.failingSince.IsZero() {
+		c.failingSince = time.Now()
+	}
+	c.lastError = err
+}
+
+// checkWatch returns an error once the node watch has been failing for
+// longer than watchFailureTolerance, as the cached nodes may then be stale
+func (c *Counter) checkWatch() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.failingSince.IsZero() || time.Since(c.failingSince) < watchFailureTolerance {
+		return nil
+	}
+	return fmt.Errorf("node watch failing since %s: %w", c.failingSince.Format(time.RFC3339), c.lastError)
+}
+
+// OnChange registers a callback invoked whenever a node is added, removed or
+// relabeled. Must be called before Start.
+func (c *Counter) OnChange(fn func()) error {
+	_, err := c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			fn()
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNode, okOld := oldObj.(*corev1.Node)
+			newNode, okNew := newObj.(*corev1.Node)
+			if okOld && okNew && !nodeChanged(oldNode, newNode) {
+				return
+			}
+			fn()
+		},
+		DeleteFunc: func(obj interface{}) {
+			fn()
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add node event handler: %w", err)
+	}
+	return nil
+}
+
+// nodeChanged reports whether a node update can change counts or capacity:
+// its labels or allocatable resources changed. Status heartbeats change
+// neither.
+func nodeChanged(oldNode, newNode *corev1.Node) bool {
+	if !reflect.DeepEqual(oldNode.Labels, newNode.Labels) {
+		return true
+	}
+	if len(oldNode.Status.Allocatable) != len(newNode.Status.Allocatable) {
+		return true
+	}
+	for name, quantity := range newNode.Status.Allocatable {
+		old, ok := oldNode.Status.Allocatable[name]
+		if !ok || old.Cmp(quantity) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Start starts the node informer and waits for its cache to sync
+func (c *Counter) Start(ctx context.Context) error {
+	go c.informer.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), c.informer.HasSynced) {
+		return fmt.Errorf("failed to sync node cache")
+	}
+	return nil
 }
 
 // CountLabeledNodes counts the number of nodes with the specified label
 func (c *Counter) CountLabeledNodes(ctx context.Context) (int, error) {
-	labelSelector := fmt.Sprintf("%s=%s", c.nodeLabelKey, c.nodeLabelValue)
+	return c.CountNodes(ctx, nil)
+}
 
-	nodes, err := c.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{
-		LabelSelector: labelSelector,
-	})
+// CountNodes counts the number of nodes matching all key/value pairs in the
+// selector. An empty selector falls back to the configured label.
+func (c *Counter) CountNodes(ctx context.Context, selector map[string]string) (int, error) {
+	if err := c.checkWatch(); err != nil {
+		return 0, err
+	}
+	nodes, err := c.lister.List(c.labelSelector(selector))
 	if err != nil {
 		return 0, fmt.Errorf("failed to list nodes: %w", err)
 	}
 
-	return len(nodes.Items), nil
+	return len(nodes), nil
+}
+
+// SetGPUResources sets the extended resources counted as GPUs
+func (c *Counter) SetGPUResources(resources []string) {
+	c.gpuResources = make([]corev1.ResourceName, 0, len(resources))
+	for _, resource := range resources {
+		c.gpuResources = append(c.gpuResources, corev1.ResourceName(resource))
+	}
+}
+
+// Measure counts the nodes matching the selector (the configured label when
+// empty) and sums their allocatable CPU, memory and GPUs. It fails while the
+// node watch cannot reach the API server, rather than count stale nodes.
+func (c *Counter) Measure(ctx context.Context, selector map[string]string) (license.Capacity, error) {
+	if err := c.checkWatch(); err != nil {
+		return license.Capacity{}, err
+	}
+	nodes, err := c.lister.List(c.labelSelector(selector))
+	if err != nil {
+		return license.Capacity{}, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	capacity := license.Capacity{Nodes: len(nodes)}
+	for _, node := range nodes {
+		allocatable := node.Status.Allocatable
+		capacity.VCPUs += float64(allocatable.Cpu().MilliValue()) / 1000
+		capacity.MemoryGiB += float64(allocatable.Memory().Value()) / (1 << 30)
+		for _, resource := range c.gpuResources {
+			if quantity, ok := allocatable[resource]; ok {
+				capacity.GPUs += int(quantity.Value())
+			}
+		}
+	}
+	return capacity, nil
+}
+
+// NodeMatches reports whether the named node matches the selector (the
+// configured label when empty). Nodes outside the watch selector are not
+// cached and never match.
+func (c *Counter) NodeMatches(name string, selector map[string]string) bool {
+	node, err := c.lister.Get(name)
+	if err != nil {
+		return false
+	}
+	return c.labelSelector(selector).Matches(labels.Set(node.Labels))
+}
+
+// labelSelector builds the node label selector, using the configured label
+// when the given selector is empty
+func (c *Counter) labelSelector(selector map[string]string) labels.Selector {
+	if len(selector) == 0 {
+		selector = map[string]string{c.nodeLabelKey: c.nodeLabelValue}
+	}
+	return labels.SelectorFromSet(selector)
 }
 
 // CountAllNodes counts all nodes in the cluster
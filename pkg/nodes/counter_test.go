@@ -0,0 +1,54 @@
+package nodes
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNodeChanged(t *testing.T) {
+	node := func(labels map[string]string, cpu string, mutate ...func(*corev1.Node)) *corev1.Node {
+		n := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: labels},
+			Status: corev1.NodeStatus{Allocatable: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(cpu),
+				corev1.ResourceMemory: resource.MustParse("16Gi"),
+			}},
+		}
+		for _, m := range mutate {
+			m(n)
+		}
+		return n
+	}
+	licensed := map[string]string{"es-products.io/licensed": "true"}
+	heartbeat := func(n *corev1.Node) {
+		n.Status.Conditions = []corev1.NodeCondition{{Type: corev1.NodeReady, LastHeartbeatTime: metav1.NewTime(time.Now())}}
+	}
+	withGPU := func(n *corev1.Node) {
+		n.Status.Allocatable["nvidia.com/gpu"] = resource.MustParse("1")
+	}
+
+	tests := []struct {
+		name     string
+		old, new *corev1.Node
+		want     bool
+	}{
+		{name: "status heartbeat", old: node(licensed, "4"), new: node(licensed, "4", heartbeat), want: false},
+		{name: "same quantity in another format", old: node(licensed, "4"), new: node(licensed, "4000m"), want: false},
+		{name: "label removed", old: node(licensed, "4"), new: node(nil, "4"), want: true},
+		{name: "allocatable CPU changed", old: node(licensed, "4"), new: node(licensed, "8"), want: true},
+		{name: "GPU became allocatable", old: node(licensed, "4"), new: node(licensed, "4", withGPU), want: true},
+		{name: "GPU no longer allocatable", old: node(licensed, "4", withGPU), new: node(licensed, "4"), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nodeChanged(tt.old, tt.new); got != tt.want {
+				t.Errorf("nodeChanged = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
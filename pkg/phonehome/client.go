@@ -4,11 +4,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/enterprisesight/es-license-validator/pkg/license"
+	"github.com/enterprisesight/es-license-validator/pkg/metering"
 )
 
 // PhoneHomeRequest represents the data sent to the license server
@@ -18,27 +22,107 @@ type PhoneHomeRequest struct {
 	ClusterName        string            `json:"cluster_name,omitempty"`
 	NodeCount          int               `json:"node_count"`
 	LicensedNodes      int               `json:"licensed_nodes"`
+	MaxNodes           int               `json:"max_nodes,omitempty"`
+	OverageNodes       int               `json:"overage_nodes"`
+	UnlicensedNodes    int               `json:"unlicensed_nodes"`
 	ValidationStatus   string            `json:"validation_status"`
 	ValidationMessage  string            `json:"validation_message,omitempty"`
 	DaysUntilExpiry    int               `json:"days_until_expiry"`
 	IsInGracePeriod    bool              `json:"is_in_grace_period"`
+	IsExpiringSoon     bool              `json:"is_expiring_soon"`
 	ProductCode        string            `json:"product_code"`
 	TierCode           string            `json:"tier_code"`
 	Timestamp          time.Time         `json:"timestamp"`
 	Metadata           map[string]string `json:"metadata,omitempty"`
+	Products           []ProductUsage    `json:"products,omitempty"`
 }
 
-// PhoneHomeResponse represents the response from the license server
+// ProductUsage represents the per-product usage sent to the license server
+type ProductUsage struct {
+	ProductCode     string `json:"product_code"`
+	TierCode        string `json:"tier_code,omitempty"`
+	NodeCount       int    `json:"node_count"`
+	LicensedNodes   int    `json:"licensed_nodes"`
+	MaxNodes        int    `json:"max_nodes,omitempty"`
+	OverageNodes    int    `json:"overage_nodes,omitempty"` // nodes beyond licensed_nodes, within max_nodes
+	UnlicensedNodes int    `json:"unlicensed_nodes,omitempty"`
+	Valid           bool   `json:"valid"`
+
+	// Usage and limit of each capacity dimension the license declares
+	Dimensions []DimensionUsage `json:"dimensions,omitempty"`
+
+	// Metered usage over the retained days, with the most recent daily
+	// aggregates; the server upserts daily aggregates by date
+	NodeHours  float64               `json:"node_hours,omitempty"`
+	PeakNodes  int                   `json:"peak_nodes,omitempty"`
+	DailyUsage []metering.DailyUsage `json:"daily_usage,omitempty"`
+}
+
+// DimensionUsage reports one licensed capacity dimension of a product
+type DimensionUsage struct {
+	Dimension string  `json:"dimension"` // nodes, vcpus, memory_gib or gpus
+	Used      float64 `json:"used"`
+	Licensed  float64 `json:"licensed"`
+	Max       float64 `json:"max,omitempty"`
+	Valid     bool    `json:"valid"`
+	Overage   bool    `json:"overage,omitempty"`
+}
+
+// usageReportDays is the number of most recent daily usage aggregates sent
+// with each request
+const usageReportDays = 7
+
+// UsageFunc returns the metered usage of a product, if any
+type UsageFunc func(productCode string) (metering.ProductUsage, bool)
+
+// PhoneHomeResponse represents the response from the license server. The
+// server may optionally push a renewed license, a revocation list or new
+// check-in parameters.
 type PhoneHomeResponse struct {
-	Status  string `json:"status"`
-	Message string `json:"message,omitempty"`
+	Status         string   `json:"status"`
+	Message        string   `json:"message,omitempty"`
+	License        string   `json:"license,omitempty"`         // renewed license JWT
+	RevocationList string   `json:"revocation_list,omitempty"` // signed revocation list JWT
+	CheckIn        *CheckIn `json:"check_in,omitempty"`
+
+	// ServerTime is the license server's Date header, zero if absent
+	ServerTime time.Time `json:"-"`
+}
+
+// CheckIn carries updated phone home parameters from the license server
+type CheckIn struct {
+	Enabled       *bool  `json:"enabled,omitempty"`
+	URL           string `json:"url,omitempty"`
+	IntervalHours int    `json:"interval_hours,omitempty"`
 }
 
-// Client handles communication with the license server
+// ResponseHandler is called with every accepted phone home request and the
+// server's response, including replays from the outbox
+type ResponseHandler func(req PhoneHomeRequest, resp *PhoneHomeResponse)
+
+// ErrQueued is returned by SendPhoneHome when the request was queued behind
+// earlier undelivered requests instead of being sent
+var ErrQueued = errors.New("phone home queued behind undelivered reports")
+
+// ErrRejected wraps responses that will not succeed on retry: a 4xx status
+// other than 408 and 429, or a response whose status is not a success
+var ErrRejected = errors.New("phone home rejected by license server")
+
+const (
+	outboxInitialBackoff = 10 * time.Second
+	outboxMaxBackoff     = 10 * time.Minute
+)
+
+// Client handles communication with the license server. In offline mode
+// requests are appended to a local report instead of being sent.
 type Client struct {
 	serverURL  string
 	httpClient *http.Client
 	retries    int
+	report     *Report
+	outbox     *Outbox
+	onResponse ResponseHandler
+	usage      UsageFunc
 }
 
 // NewClient creates a new phone home client
@@ -52,8 +136,27 @@ func NewClient(serverURL string, timeout time.Duration, retries int) *Client {
 	}
 }
 
+// NewOfflineClient creates a phone home client that appends every request to
+// the hash-chained report at reportPath, authenticated with the report key,
+// instead of contacting a server
+func NewOfflineClient(reportPath string, reportKey []byte) (*Client, error) {
+	report, err := OpenReport(reportPath, reportKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open offline report: %w", err)
+	}
+	return &Client{
+		report: report,
+	}, nil
+}
+
 // SendPhoneHome sends validation data to the license server
 func (c *Client) SendPhoneHome(ctx context.Context, validationResult *license.ValidationResult) error {
+	return c.SendPhoneHomeTo(ctx, c.serverURL, validationResult)
+}
+
+// SendPhoneHomeTo sends validation data to the given license server, e.g. the
+// URL from the license's phone_home claim
+func (c *Client) SendPhoneHomeTo(ctx context.Context, serverURL string, validationResult *license.ValidationResult) error {
 	if validationResult == nil || validationResult.License == nil {
 		return fmt.Errorf("validation result or license is nil")
 	}
@@ -67,10 +170,14 @@ func (c *Client) SendPhoneHome(ctx context.Context, validationResult *license.Va
 		ClusterName:       lic.ClusterName,
 		NodeCount:         validationResult.NodeCount,
 		LicensedNodes:     validationResult.LicensedNodes,
+		MaxNodes:          validationResult.MaxNodes,
+		OverageNodes:      validationResult.OverageNodes,
+		UnlicensedNodes:   validationResult.UnlicensedNodes,
 		ValidationStatus:  getValidationStatus(validationResult),
 		ValidationMessage: getValidationMessage(validationResult),
 		DaysUntilExpiry:   validationResult.DaysUntilExpiry,
 		IsInGracePeriod:   validationResult.IsInGracePeriod,
+		IsExpiringSoon:    validationResult.ExpiringSoon,
 		ProductCode:       lic.ProductCode,
 		TierCode:          lic.TierCode,
 		Timestamp:         time.Now(),
@@ -82,6 +189,56 @@ func (c *Client) SendPhoneHome(ctx context.Context, validationResult *license.Va
 		},
 	}
 
+	for _, product := range validationResult.Products {
+		usage := ProductUsage{
+			ProductCode:   product.ProductCode,
+			TierCode:      product.TierCode,
+			NodeCount:     product.NodeCount,
+			LicensedNodes: product.LicensedNodes,
+			MaxNodes:      product.MaxNodes,
+			OverageNodes:  product.OverageNodes,
+			Valid:         product.Valid,
+		}
+		if product.Placement != nil {
+			usage.UnlicensedNodes = len(product.Placement.UnlicensedNodes)
+		}
+		for _, dimension := range product.Dimensions {
+			usage.Dimensions = append(usage.Dimensions, DimensionUsage{
+				Dimension: dimension.Dimension,
+				Used:      dimension.Used,
+				Licensed:  dimension.Licensed,
+				Max:       dimension.Max,
+				Valid:     dimension.Valid,
+				Overage:   dimension.Overage,
+			})
+		}
+		if c.usage != nil {
+			if metered, ok := c.usage(product.ProductCode); ok {
+				usage.NodeHours = metered.NodeHours
+				usage.PeakNodes = metered.PeakNodes
+				usage.DailyUsage = metered.Days[max(0, len(metered.Days)-usageReportDays):]
+			}
+		}
+		req.Products = append(req.Products, usage)
+	}
+
+	// Offline mode: record locally instead of sending
+	if c.report != nil {
+		return c.report.Append(req)
+	}
+
+	if serverURL == "" {
+		return fmt.Errorf("no license server URL configured")
+	}
+
+	// Preserve delivery order: queue behind reports still waiting for replay
+	if c.outbox != nil && c.outbox.Len() > 0 {
+		if err := c.outbox.Enqueue(serverURL, req); err != nil {
+			return fmt.Errorf("failed to queue phone home: %w", err)
+		}
+		return ErrQueued
+	}
+
 	// Send with retries
 	var lastErr error
 	for attempt := 0; attempt <= c.retries; attempt++ {
@@ -90,22 +247,127 @@ func (c *Client) SendPhoneHome(ctx context.Context, validationResult *license.Va
 			backoff := time.Duration(attempt*attempt) * time.Second
 			select {
 			case <-ctx.Done():
-				return ctx.Err()
+				lastErr = ctx.Err()
 			case <-time.After(backoff):
 			}
+			if ctx.Err() != nil {
+				break
+			}
 		}
 
-		err := c.sendRequest(ctx, req)
+		err := c.sendRequest(ctx, serverURL, req)
 		if err == nil {
 			return nil
 		}
+		if errors.Is(err, ErrRejected) {
+			// Neither retrying nor replaying will change the answer
+			return err
+		}
 		lastErr = err
 	}
 
-	return fmt.Errorf("phone home failed after %d retries: %w", c.retries, lastErr)
+	err := fmt.Errorf("phone home failed after %d retries: %w", c.retries, lastErr)
+
+	// Keep the report for replay instead of dropping it
+	if c.outbox != nil {
+		if qerr := c.outbox.Enqueue(serverURL, req); qerr != nil {
+			return fmt.Errorf("%w (failed to queue for replay: %v)", err, qerr)
+		}
+		return fmt.Errorf("%w (queued for replay)", err)
+	}
+	return err
+}
+
+// SetResponseHandler registers a handler for license server responses
+func (c *Client) SetResponseHandler(handler ResponseHandler) {
+	c.onResponse = handler
+}
+
+// SetUsageSource adds metered usage to the products of every request
+func (c *Client) SetUsageSource(usage UsageFunc) {
+	c.usage = usage
+}
+
+// EnableOutbox makes the client queue undelivered requests in outbox. Call
+// RunOutbox to replay them.
+func (c *Client) EnableOutbox(outbox *Outbox) {
+	c.outbox = outbox
+}
+
+// OutboxStats returns the outbox depth and oldest entry, if an outbox is enabled
+func (c *Client) OutboxStats() (OutboxStats, bool) {
+	if c.outbox == nil {
+		return OutboxStats{}, false
+	}
+	return c.outbox.Stats(), true
+}
+
+// RunOutbox replays queued requests in order until ctx is done, backing off
+// exponentially while the license server is unreachable
+func (c *Client) RunOutbox(ctx context.Context) {
+	if c.outbox == nil {
+		return
+	}
+
+	backoff := outboxInitialBackoff
+	for {
+		entry, ok := c.outbox.head()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.outbox.notify:
+				continue
+			}
+		}
+
+		sendCtx, cancel := context.WithTimeout(ctx, c.httpClient.Timeout)
+		serverURL := entry.ServerURL
+		if serverURL == "" {
+			serverURL = c.serverURL
+		}
+		err := c.sendRequest(sendCtx, serverURL, entry.Request)
+		cancel()
+
+		if err == nil {
+			if err := c.outbox.remove(entry.ID); err != nil {
+				slog.Error("Failed to remove delivered phone home from outbox", "error", err)
+			}
+			slog.Info("Replayed queued phone home",
+				"license_id", entry.Request.LicenseID, "enqueued_at", entry.EnqueuedAt, "attempts", entry.Attempts+1)
+			backoff = outboxInitialBackoff
+			continue
+		}
+
+		dead, rerr := c.outbox.recordFailure(entry.ID, err)
+		if rerr != nil {
+			slog.Error("Failed to update phone home outbox", "error", rerr)
+		}
+		if dead {
+			slog.Error("Gave up on queued phone home",
+				"license_id", entry.Request.LicenseID, "enqueued_at", entry.EnqueuedAt,
+				"attempts", entry.Attempts+1, "error", err)
+			if errors.Is(err, ErrRejected) {
+				// The server answered; move on to the next entry right away
+				continue
+			}
+		}
+		slog.Warn("Phone home replay failed, backing off",
+			"license_id", entry.Request.LicenseID, "backoff", backoff, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > outboxMaxBackoff {
+			backoff = outboxMaxBackoff
+		}
+	}
 }
 
-func (c *Client) sendRequest(ctx context.Context, req PhoneHomeRequest) error {
+func (c *Client) sendRequest(ctx context.Context, serverURL string, req PhoneHomeRequest) error {
 	// Marshal request
 	body, err := json.Marshal(req)
 	if err != nil {
@@ -113,7 +375,7 @@ func (c *Client) sendRequest(ctx context.Context, req PhoneHomeRequest) error {
 	}
 
 	// Create HTTP request
-	url := fmt.Sprintf("%s/api/v1/validate", c.serverURL)
+	url := fmt.Sprintf("%s/api/v1/validate", serverURL)
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
@@ -131,7 +393,12 @@ func (c *Client) sendRequest(ctx context.Context, req PhoneHomeRequest) error {
 
 	// Check response
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("server returned error status: %d", resp.StatusCode)
+		err := fmt.Errorf("server returned error status: %d", resp.StatusCode)
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+			resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return fmt.Errorf("%w: %w", ErrRejected, err)
+		}
+		return err
 	}
 
 	// Parse response
@@ -141,13 +408,43 @@ func (c *Client) sendRequest(ctx context.Context, req PhoneHomeRequest) error {
 	}
 
 	if phoneHomeResp.Status != "success" && phoneHomeResp.Status != "ok" {
-		return fmt.Errorf("phone home failed: %s", phoneHomeResp.Message)
+		return fmt.Errorf("%w: status %q: %s", ErrRejected, phoneHomeResp.Status, phoneHomeResp.Message)
+	}
+
+	if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		phoneHomeResp.ServerTime = date
+	}
+
+	if c.onResponse != nil {
+		c.onResponse(req, &phoneHomeResp)
 	}
 
 	return nil
 }
 
+// ValidationStatus returns the status string reported to the license server
+// for a validation result, e.g. "valid", "grace_period" or "expired"
+func ValidationStatus(result *license.ValidationResult) string {
+	return getValidationStatus(result)
+}
+
 func getValidationStatus(result *license.ValidationResult) string {
+	if result.Revoked {
+		return "revoked"
+	}
+	if !result.NotBeforeValid && result.License != nil {
+		return "not_yet_valid"
+	}
+	// Grace period results are also Valid, so check for grace first
+	if result.IsInGracePeriod && result.Valid {
+		return "grace_period"
+	}
+	if result.Valid && result.Overage {
+		return "overage"
+	}
+	if result.Valid && result.ExpiringSoon {
+		return "expiring_soon"
+	}
 	if result.Valid {
 		return "valid"
 	}
@@ -157,16 +454,40 @@ func getValidationStatus(result *license.ValidationResult) string {
 	if !result.ExpiryValid {
 		return "expired"
 	}
+	if result.NodeCountUnavailable {
+		return "node_count_unavailable"
+	}
 	if !result.NodeCountValid {
 		return "node_limit_exceeded"
 	}
+	if !result.CapacityValid {
+		return "capacity_exceeded"
+	}
+	if !result.NamespaceValid && result.License != nil {
+		return "namespace_mismatch"
+	}
 	if !result.SignatureValid {
 		return "invalid_signature"
 	}
 	return "invalid"
 }
 
+// ValidationMessage returns the human-readable message reported to the
+// license server for a validation result
+func ValidationMessage(result *license.ValidationResult) string {
+	return getValidationMessage(result)
+}
+
 func getValidationMessage(result *license.ValidationResult) string {
+	if result.IsInGracePeriod && result.Valid {
+		return fmt.Sprintf("License expired but in grace period (%d days since expiry)", -result.DaysUntilExpiry)
+	}
+	if result.Valid && result.Overage {
+		return fmt.Sprintf("Node count (%d) exceeds licensed nodes (%d); %d nodes billed as overage", result.NodeCount, result.LicensedNodes, result.OverageNodes)
+	}
+	if result.Valid && result.ExpiringSoon {
+		return fmt.Sprintf("License expires in %d days", result.DaysUntilExpiry)
+	}
 	if result.Valid {
 		return "License is valid"
 	}
@@ -180,8 +501,22 @@ func getValidationMessage(result *license.ValidationResult) string {
 		return "License has expired"
 	}
 	if !result.NodeCountValid {
+		if result.MaxNodes > result.LicensedNodes {
+			return fmt.Sprintf("Node count (%d) exceeds max nodes (%d)", result.NodeCount, result.MaxNodes)
+		}
 		return fmt.Sprintf("Node count (%d) exceeds licensed nodes (%d)", result.NodeCount, result.LicensedNodes)
 	}
+	if !result.CapacityValid {
+		var exceeded []string
+		for _, product := range result.Products {
+			for _, dimension := range product.Dimensions {
+				if !dimension.Valid {
+					exceeded = append(exceeded, dimension.String())
+				}
+			}
+		}
+		return "Capacity exceeds license: " + strings.Join(exceeded, ", ")
+	}
 	if !result.SignatureValid {
 		return "Invalid license signature"
 	}
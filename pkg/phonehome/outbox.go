@@ -0,0 +1,233 @@
+package phonehome
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// OutboxEntry is an undelivered phone home request waiting for replay
+type OutboxEntry struct {
+	ID         int64            `json:"id"`
+	EnqueuedAt time.Time        `json:"enqueued_at"`
+	Attempts   int              `json:"attempts"`
+	LastError  string           `json:"last_error,omitempty"`
+	ServerURL  string           `json:"server_url,omitempty"`
+	Request    PhoneHomeRequest `json:"request"`
+}
+
+// OutboxStats summarizes the outbox for the status endpoint
+type OutboxStats struct {
+	Depth            int
+	OldestEnqueuedAt time.Time // zero when empty
+	DeadLettered     int       // entries given up on since startup
+}
+
+// Outbox is a persistent FIFO queue of undelivered phone home requests. The
+// queue is stored as a JSON file, rewritten atomically on every change; an
+// empty path keeps it in memory only. Entries the server rejects or that
+// reach the attempt limit are appended to a dead letter file next to it.
+type Outbox struct {
+	path        string
+	maxEntries  int
+	maxAttempts int
+	notify      chan struct{}
+
+	mu           sync.Mutex
+	entries      []OutboxEntry
+	nextID       int64
+	deadLettered int
+}
+
+// OpenOutbox opens the outbox at path, loading any entries left from a
+// previous run. When more than maxEntries are queued the oldest are dropped;
+// entries are given up on after maxAttempts failed replays (0 retries forever).
+func OpenOutbox(path string, maxEntries, maxAttempts int) (*Outbox, error) {
+	o := &Outbox{
+		path:        path,
+		maxEntries:  maxEntries,
+		maxAttempts: maxAttempts,
+		notify:      make(chan struct{}, 1),
+		nextID:      1,
+	}
+	if path == "" {
+		return o, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create outbox directory: %w", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read outbox: %w", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &o.entries); err != nil {
+			return nil, fmt.Errorf("failed to parse outbox: %w", err)
+		}
+		if n := len(o.entries); n > 0 {
+			o.nextID = o.entries[n-1].ID + 1
+		}
+	}
+	return o, nil
+}
+
+// Enqueue appends a request for the given license server to the end of the queue
+func (o *Outbox) Enqueue(serverURL string, req PhoneHomeRequest) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.entries = append(o.entries, OutboxEntry{
+		ID:         o.nextID,
+		EnqueuedAt: time.Now(),
+		ServerURL:  serverURL,
+		Request:    req,
+	})
+	o.nextID++
+
+	if o.maxEntries > 0 && len(o.entries) > o.maxEntries {
+		dropped := len(o.entries) - o.maxEntries
+		slog.Warn("Phone home outbox full, dropping oldest entries", "dropped", dropped, "max_entries", o.maxEntries)
+		o.entries = append([]OutboxEntry(nil), o.entries[dropped:]...)
+	}
+
+	if err := o.save(); err != nil {
+		return err
+	}
+
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Len returns the number of queued requests
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.entries)
+}
+
+// Stats returns the queue depth and the age of the oldest entry
+func (o *Outbox) Stats() OutboxStats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	stats := OutboxStats{Depth: len(o.entries), DeadLettered: o.deadLettered}
+	if len(o.entries) > 0 {
+		stats.OldestEnqueuedAt = o.entries[0].EnqueuedAt
+	}
+	return stats
+}
+
+// head returns the oldest queued entry
+func (o *Outbox) head() (OutboxEntry, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.entries) == 0 {
+		return OutboxEntry{}, false
+	}
+	return o.entries[0], true
+}
+
+// remove deletes a delivered entry
+func (o *Outbox) remove(id int64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for i, entry := range o.entries {
+		if entry.ID == id {
+			o.entries = append(o.entries[:i:i], o.entries[i+1:]...)
+			return o.save()
+		}
+	}
+	return nil
+}
+
+// recordFailure notes a failed delivery attempt for an entry. An entry the
+// server rejected, or that reached the attempt limit, is moved to the dead
+// letter file; dead reports whether that happened.
+func (o *Outbox) recordFailure(id int64, sendErr error) (dead bool, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for i := range o.entries {
+		if o.entries[i].ID != id {
+			continue
+		}
+		entry := &o.entries[i]
+		entry.Attempts++
+		entry.LastError = sendErr.Error()
+
+		if !errors.Is(sendErr, ErrRejected) && (o.maxAttempts <= 0 || entry.Attempts < o.maxAttempts) {
+			return false, o.save()
+		}
+
+		derr := o.deadLetter(*entry)
+		o.entries = append(o.entries[:i:i], o.entries[i+1:]...)
+		o.deadLettered++
+		if err := o.save(); err != nil {
+			return true, err
+		}
+		return true, derr
+	}
+	return false, nil
+}
+
+// deadLetterPath returns where given-up entries are kept
+func (o *Outbox) deadLetterPath() string {
+	return o.path + ".dead"
+}
+
+// deadLetter appends an entry to the dead letter file as a JSON line. Callers
+// must hold o.mu.
+func (o *Outbox) deadLetter(entry OutboxEntry) error {
+	if o.path == "" {
+		return nil
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter: %w", err)
+	}
+
+	f, err := os.OpenFile(o.deadLetterPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open dead letter file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write dead letter: %w", err)
+	}
+	return nil
+}
+
+// save writes the queue to disk atomically. Callers must hold o.mu.
+func (o *Outbox) save() error {
+	if o.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(o.entries)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox: %w", err)
+	}
+
+	tmp := o.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write outbox: %w", err)
+	}
+	if err := os.Rename(tmp, o.path); err != nil {
+		return fmt.Errorf("failed to replace outbox: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package phonehome
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/enterprisesight/es-license-validator/pkg/license"
+)
+
+func TestOutboxPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.json")
+
+	outbox, err := OpenOutbox(path, 0, 0)
+	if err != nil {
+		t.Fatalf("OpenOutbox: %v", err)
+	}
+	for i := 1; i <= 3; i++ {
+		if err := outbox.Enqueue("https://license.example", PhoneHomeRequest{LicenseID: "lic-1", NodeCount: i}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	reopened, err := OpenOutbox(path, 0, 0)
+	if err != nil {
+		t.Fatalf("OpenOutbox: %v", err)
+	}
+	if reopened.Len() != 3 {
+		t.Fatalf("reopened outbox has %d entries, want 3", reopened.Len())
+	}
+	head, _ := reopened.head()
+	if head.Request.NodeCount != 1 || head.ServerURL != "https://license.example" {
+		t.Errorf("head = %+v, want the first request", head)
+	}
+	if err := reopened.Enqueue("", PhoneHomeRequest{}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if last := reopened.entries[len(reopened.entries)-1]; last.ID != 4 {
+		t.Errorf("new entry ID = %d, want 4", last.ID)
+	}
+}
+
+func TestOutboxDropsOldest(t *testing.T) {
+	for _, path := range []string{"", filepath.Join(t.TempDir(), "outbox.json")} {
+		outbox, err := OpenOutbox(path, 2, 0)
+		if err != nil {
+			t.Fatalf("OpenOutbox(%q): %v", path, err)
+		}
+		for i := 1; i <= 3; i++ {
+			if err := outbox.Enqueue("", PhoneHomeRequest{NodeCount: i}); err != nil {
+				t.Fatalf("Enqueue: %v", err)
+			}
+		}
+		if outbox.Len() != 2 {
+			t.Fatalf("outbox %q has %d entries, want 2", path, outbox.Len())
+		}
+		if head, _ := outbox.head(); head.Request.NodeCount != 2 {
+			t.Errorf("outbox %q head = request %d, want 2", path, head.Request.NodeCount)
+		}
+	}
+}
+
+func TestOutboxRecordFailure(t *testing.T) {
+	retryable := errors.New("server returned error status: 503")
+	rejected := fmt.Errorf("%w: server returned error status: 400", ErrRejected)
+
+	tests := []struct {
+		name        string
+		maxAttempts int
+		failures    []error
+		dead        bool
+	}{
+		{name: "retryable failure stays queued", maxAttempts: 3, failures: []error{retryable, retryable}},
+		{name: "rejection is dead-lettered at once", maxAttempts: 3, failures: []error{rejected}, dead: true},
+		{name: "attempt limit reached", maxAttempts: 3, failures: []error{retryable, retryable, retryable}, dead: true},
+		{name: "no attempt limit", maxAttempts: 0, failures: []error{retryable, retryable, retryable, retryable}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "outbox.json")
+			outbox, err := OpenOutbox(path, 0, tt.maxAttempts)
+			if err != nil {
+				t.Fatalf("OpenOutbox: %v", err)
+			}
+			if err := outbox.Enqueue("", PhoneHomeRequest{LicenseID: "lic-1"}); err != nil {
+				t.Fatalf("Enqueue: %v", err)
+			}
+
+			var dead bool
+			for _, failure := range tt.failures {
+				if dead, err = outbox.recordFailure(1, failure); err != nil {
+					t.Fatalf("recordFailure: %v", err)
+				}
+			}
+			if dead != tt.dead {
+				t.Errorf("dead = %v, want %v", dead, tt.dead)
+			}
+
+			stats := outbox.Stats()
+			data, _ := os.ReadFile(outbox.deadLetterPath())
+			if tt.dead {
+				if stats.Depth != 0 || stats.DeadLettered != 1 {
+					t.Errorf("stats = %+v, want the entry dead-lettered", stats)
+				}
+				var entry OutboxEntry
+				if err := json.Unmarshal(data, &entry); err != nil || entry.Request.LicenseID != "lic-1" {
+					t.Errorf("dead letter file = %q (%v)", data, err)
+				}
+				return
+			}
+			if stats.Depth != 1 || stats.DeadLettered != 0 || len(data) != 0 {
+				t.Errorf("stats = %+v, dead letters %q, want the entry still queued", stats, data)
+			}
+			if head, _ := outbox.head(); head.Attempts != len(tt.failures) || head.LastError == "" {
+				t.Errorf("head = %+v, want %d attempts recorded", head, len(tt.failures))
+			}
+		})
+	}
+}
+
+func TestRunOutboxReplaysInOrder(t *testing.T) {
+	var mu sync.Mutex
+	var received []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req PhoneHomeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		received = append(received, req.NodeCount)
+		mu.Unlock()
+		if req.NodeCount == 2 {
+			http.Error(w, "malformed report", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"status": "success"}`)
+	}))
+	defer server.Close()
+
+	outbox, err := OpenOutbox(filepath.Join(t.TempDir(), "outbox.json"), 0, 0)
+	if err != nil {
+		t.Fatalf("OpenOutbox: %v", err)
+	}
+	for i := 1; i <= 3; i++ {
+		if err := outbox.Enqueue(server.URL, PhoneHomeRequest{LicenseID: "lic-1", NodeCount: i}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	client := NewClient("", 5*time.Second, 0)
+	client.EnableOutbox(outbox)
+
+	var replayed []int
+	client.SetResponseHandler(func(req PhoneHomeRequest, _ *PhoneHomeResponse) {
+		replayed = append(replayed, req.NodeCount)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		client.RunOutbox(ctx)
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for outbox.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if outbox.Len() != 0 {
+		t.Fatalf("outbox still holds %d entries", outbox.Len())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(received) != "[1 2 3]" {
+		t.Errorf("server received %v, want [1 2 3]", received)
+	}
+	if fmt.Sprint(replayed) != "[1 3]" {
+		t.Errorf("accepted replays = %v, want [1 3]", replayed)
+	}
+	if stats := outbox.Stats(); stats.DeadLettered != 1 {
+		t.Errorf("dead lettered = %d, want 1", stats.DeadLettered)
+	}
+}
+
+func TestSendPhoneHomeQueuesBehindOutbox(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	outbox, err := OpenOutbox("", 0, 0)
+	if err != nil {
+		t.Fatalf("OpenOutbox: %v", err)
+	}
+	client := NewClient(server.URL, 5*time.Second, 0)
+	client.EnableOutbox(outbox)
+	result := &license.ValidationResult{License: &license.License{LicenseID: "lic-1"}}
+
+	err = client.SendPhoneHome(context.Background(), result)
+	if err == nil || !strings.Contains(err.Error(), "queued for replay") {
+		t.Fatalf("failed send: err = %v, want it queued for replay", err)
+	}
+	if err := client.SendPhoneHome(context.Background(), result); !errors.Is(err, ErrQueued) {
+		t.Fatalf("send behind a queued report: err = %v, want ErrQueued", err)
+	}
+	if requests != 1 || outbox.Len() != 2 {
+		t.Errorf("server saw %d requests and %d are queued, want 1 and 2", requests, outbox.Len())
+	}
+}
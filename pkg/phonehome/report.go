@@ -0,0 +1,282 @@
+package phonehome
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// BundleFormat identifies the exported usage report format
+const BundleFormat = "es-usage-report/v2"
+
+// minReportKeyBytes is the minimum length of a report key
+const minReportKeyBytes = 32
+
+// genesisHash is the previous hash of the first report entry
+const genesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// ReportEntry is a single hash-chained line of the offline usage report.
+// Hash covers the sequence number, the previous hash and the request bytes;
+// MAC is an HMAC-SHA256 of Hash under the installation's report key. This
+// detects corrupted, edited or reordered entries, but the key is stored in
+// the customer cluster, so whoever can read it can rewrite a consistent
+// chain: it protects integrity, it is not evidence against tampering.
+type ReportEntry struct {
+	Seq      int64           `json:"seq"`
+	PrevHash string          `json:"prev_hash"`
+	Hash     string          `json:"hash"`
+	MAC      string          `json:"mac"`
+	Request  json.RawMessage `json:"request"`
+}
+
+// ReportBundle is the export carried out of air-gapped sites. HeadMAC covers
+// the entry count and head hash, so a bundle truncated in transit fails
+// verification; like the entry MACs it is computed with a key held in the
+// customer cluster.
+type ReportBundle struct {
+	Format      string        `json:"format"`
+	KeyID       string        `json:"key_id"`
+	GeneratedAt time.Time     `json:"generated_at"`
+	EntryCount  int           `json:"entry_count"`
+	HeadHash    string        `json:"head_hash"`
+	HeadMAC     string        `json:"head_mac"`
+	Entries     []ReportEntry `json:"entries"`
+}
+
+// Report is an append-only, hash-chained file of phone home requests used
+// instead of the license server in offline mode. Its MACs detect corruption,
+// not tampering by someone holding the report key.
+type Report struct {
+	path string
+	key  []byte
+
+	mu       sync.Mutex
+	lastSeq  int64
+	lastHash string
+}
+
+// ReadReportKey reads the per-installation report key issued by the vendor.
+// Surrounding whitespace is ignored.
+func ReadReportKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report key: %w", err)
+	}
+	key := bytes.TrimSpace(data)
+	if len(key) < minReportKeyBytes {
+		return nil, fmt.Errorf("report key must be at least %d bytes", minReportKeyBytes)
+	}
+	return key, nil
+}
+
+// ReportKeyID identifies a report key without revealing it, so the vendor
+// can pick the key to verify a bundle with
+func ReportKeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// OpenReport opens the report at path, creating it if needed, authenticating
+// entries with key. The existing chain is verified so new entries are only
+// appended to an intact report.
+func OpenReport(path string, key []byte) (*Report, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create report directory: %w", err)
+	}
+
+	entries, err := ReadReport(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err := VerifyChain(entries, key); err != nil {
+		return nil, fmt.Errorf("existing report is corrupt: %w", err)
+	}
+
+	report := &Report{
+		path:     path,
+		key:      key,
+		lastHash: genesisHash,
+	}
+	if len(entries) > 0 {
+		last := entries[len(entries)-1]
+		report.lastSeq = last.Seq
+		report.lastHash = last.Hash
+	}
+	return report, nil
+}
+
+// Append adds a phone home request to the end of the report
+func (r *Report) Append(req PhoneHomeRequest) error {
+	request, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry := ReportEntry{
+		Seq:      r.lastSeq + 1,
+		PrevHash: r.lastHash,
+		Request:  request,
+	}
+	entry.Hash = entryHash(entry)
+	entry.MAC = mac(r.key, entry.Hash)
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal report entry: %w", err)
+	}
+
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open report: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write report entry: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync report: %w", err)
+	}
+
+	r.lastSeq = entry.Seq
+	r.lastHash = entry.Hash
+	return nil
+}
+
+// ReadReport reads all entries of the report at path
+func ReadReport(path string) ([]ReportEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open report: %w", err)
+	}
+	defer f.Close()
+
+	var entries []ReportEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry ReportEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse report line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read report: %w", err)
+	}
+	return entries, nil
+}
+
+// VerifyChain checks that entries form an unbroken hash chain from the start,
+// each authenticated with key
+func VerifyChain(entries []ReportEntry, key []byte) error {
+	prevHash := genesisHash
+	for i, entry := range entries {
+		if entry.Seq != int64(i+1) {
+			return fmt.Errorf("entry %d has sequence %d", i+1, entry.Seq)
+		}
+		if entry.PrevHash != prevHash {
+			return fmt.Errorf("entry %d does not link to the previous entry", entry.Seq)
+		}
+		if entryHash(entry) != entry.Hash {
+			return fmt.Errorf("entry %d hash mismatch", entry.Seq)
+		}
+		if !hmac.Equal([]byte(mac(key, entry.Hash)), []byte(entry.MAC)) {
+			return fmt.Errorf("entry %d is not authenticated by the report key", entry.Seq)
+		}
+		prevHash = entry.Hash
+	}
+	return nil
+}
+
+// ExportBundle verifies the report at path against key and writes it to w
+// as a bundle
+func ExportBundle(path string, key []byte, w io.Writer) error {
+	entries, err := ReadReport(path)
+	if err != nil {
+		return err
+	}
+	if err := VerifyChain(entries, key); err != nil {
+		return fmt.Errorf("report failed verification: %w", err)
+	}
+
+	bundle := ReportBundle{
+		Format:      BundleFormat,
+		KeyID:       ReportKeyID(key),
+		GeneratedAt: time.Now().UTC(),
+		EntryCount:  len(entries),
+		HeadHash:    genesisHash,
+		Entries:     entries,
+	}
+	if len(entries) > 0 {
+		bundle.HeadHash = entries[len(entries)-1].Hash
+	}
+	bundle.HeadMAC = mac(key, headMessage(bundle))
+
+	// Not indented: entry hashes cover the compact request bytes
+	if err := json.NewEncoder(w).Encode(bundle); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	return nil
+}
+
+// VerifyBundle checks a bundle's head and entries against key, as the
+// vendor does on upload
+func VerifyBundle(bundle ReportBundle, key []byte) error {
+	if bundle.Format != BundleFormat {
+		return fmt.Errorf("unsupported bundle format %q", bundle.Format)
+	}
+	if !hmac.Equal([]byte(mac(key, headMessage(bundle))), []byte(bundle.HeadMAC)) {
+		return fmt.Errorf("bundle head is not authenticated by the report key")
+	}
+	if bundle.EntryCount != len(bundle.Entries) {
+		return fmt.Errorf("bundle has %d entries, head declares %d", len(bundle.Entries), bundle.EntryCount)
+	}
+	head := genesisHash
+	if len(bundle.Entries) > 0 {
+		head = bundle.Entries[len(bundle.Entries)-1].Hash
+	}
+	if head != bundle.HeadHash {
+		return fmt.Errorf("bundle head hash does not match its last entry")
+	}
+	return VerifyChain(bundle.Entries, key)
+}
+
+// headMessage is the bundle head authenticated by HeadMAC
+func headMessage(bundle ReportBundle) string {
+	return fmt.Sprintf("%s|%s|%s|%d|%s", bundle.Format, bundle.KeyID,
+		bundle.GeneratedAt.Format(time.RFC3339Nano), bundle.EntryCount, bundle.HeadHash)
+}
+
+func mac(key []byte, message string) string {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(message))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func entryHash(entry ReportEntry) string {
+	h := sha256.New()
+	h.Write([]byte(strconv.FormatInt(entry.Seq, 10)))
+	h.Write([]byte{'|'})
+	h.Write([]byte(entry.PrevHash))
+	h.Write([]byte{'|'})
+	h.Write(entry.Request)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,193 @@
+package phonehome
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testReportKey = []byte("0123456789abcdef0123456789abcdef")
+
+// writeReport appends n requests to a new report and returns its path
+func writeReport(t *testing.T, n int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "report.jsonl")
+	report, err := OpenReport(path, testReportKey)
+	if err != nil {
+		t.Fatalf("OpenReport: %v", err)
+	}
+	for i := 0; i < n; i++ {
+		if err := report.Append(PhoneHomeRequest{LicenseID: "lic-1", NodeCount: i + 1}); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	return path
+}
+
+// rewriteReport replaces the report at path with entries
+func rewriteReport(t *testing.T, path string, entries []ReportEntry) {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			t.Fatalf("failed to marshal entry: %v", err)
+		}
+		buf.Write(append(line, '\n'))
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("failed to write report: %v", err)
+	}
+}
+
+func TestReportChain(t *testing.T) {
+	path := writeReport(t, 3)
+
+	// Reopening continues the chain
+	report, err := OpenReport(path, testReportKey)
+	if err != nil {
+		t.Fatalf("OpenReport: %v", err)
+	}
+	if err := report.Append(PhoneHomeRequest{LicenseID: "lic-1", NodeCount: 4}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	entries, err := ReadReport(path)
+	if err != nil {
+		t.Fatalf("ReadReport: %v", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("report has %d entries, want 4", len(entries))
+	}
+	if err := VerifyChain(entries, testReportKey); err != nil {
+		t.Errorf("VerifyChain: %v", err)
+	}
+	if entries[0].PrevHash != genesisHash {
+		t.Errorf("first entry links to %s, want the genesis hash", entries[0].PrevHash)
+	}
+}
+
+func TestVerifyChainDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func([]ReportEntry) []ReportEntry
+		key    []byte
+	}{
+		{
+			name: "edited request",
+			tamper: func(e []ReportEntry) []ReportEntry {
+				e[1].Request = json.RawMessage(strings.Replace(string(e[1].Request), `"node_count":2`, `"node_count":1`, 1))
+				return e
+			},
+		},
+		{
+			name: "edited request with recomputed hash",
+			tamper: func(e []ReportEntry) []ReportEntry {
+				e[1].Request = json.RawMessage(strings.Replace(string(e[1].Request), `"node_count":2`, `"node_count":1`, 1))
+				e[1].Hash = entryHash(e[1])
+				return e
+			},
+		},
+		{
+			name:   "dropped entry",
+			tamper: func(e []ReportEntry) []ReportEntry { return append(e[:1], e[2:]...) },
+		},
+		{
+			name:   "reordered entries",
+			tamper: func(e []ReportEntry) []ReportEntry { e[1], e[2] = e[2], e[1]; return e },
+		},
+		{
+			name:   "wrong key",
+			tamper: func(e []ReportEntry) []ReportEntry { return e },
+			key:    []byte("another key of at least 32 bytes!"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeReport(t, 3)
+			entries, err := ReadReport(path)
+			if err != nil {
+				t.Fatalf("ReadReport: %v", err)
+			}
+
+			key := tt.key
+			if key == nil {
+				key = testReportKey
+			}
+			entries = tt.tamper(entries)
+			if err := VerifyChain(entries, key); err == nil {
+				t.Error("VerifyChain accepted a tampered report")
+			}
+
+			rewriteReport(t, path, entries)
+			if _, err := OpenReport(path, key); err == nil {
+				t.Error("OpenReport appended to a tampered report")
+			}
+		})
+	}
+}
+
+func TestExportBundle(t *testing.T) {
+	path := writeReport(t, 3)
+
+	var buf bytes.Buffer
+	if err := ExportBundle(path, testReportKey, &buf); err != nil {
+		t.Fatalf("ExportBundle: %v", err)
+	}
+
+	var bundle ReportBundle
+	if err := json.Unmarshal(buf.Bytes(), &bundle); err != nil {
+		t.Fatalf("failed to parse bundle: %v", err)
+	}
+	if bundle.Format != BundleFormat || bundle.KeyID != ReportKeyID(testReportKey) || bundle.EntryCount != 3 {
+		t.Errorf("bundle head = %s %s %d", bundle.Format, bundle.KeyID, bundle.EntryCount)
+	}
+	if err := VerifyBundle(bundle, testReportKey); err != nil {
+		t.Fatalf("VerifyBundle: %v", err)
+	}
+
+	truncated := bundle
+	truncated.Entries = bundle.Entries[:2]
+	if err := VerifyBundle(truncated, testReportKey); err == nil {
+		t.Error("VerifyBundle accepted a bundle with its last entry dropped")
+	}
+
+	recounted := truncated
+	recounted.EntryCount = 2
+	recounted.HeadHash = truncated.Entries[1].Hash
+	if err := VerifyBundle(recounted, testReportKey); err == nil {
+		t.Error("VerifyBundle accepted a truncated bundle with an edited head")
+	}
+
+	if err := VerifyBundle(bundle, []byte("another key of at least 32 bytes!")); err == nil {
+		t.Error("VerifyBundle accepted a bundle under the wrong key")
+	}
+}
+
+func TestReadReportKey(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "key")
+	if err := os.WriteFile(path, append(testReportKey, '\n'), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	key, err := ReadReportKey(path)
+	if err != nil {
+		t.Fatalf("ReadReportKey: %v", err)
+	}
+	if !bytes.Equal(key, testReportKey) {
+		t.Errorf("key = %q, want trailing whitespace trimmed", key)
+	}
+
+	short := filepath.Join(dir, "short")
+	if err := os.WriteFile(short, []byte("too short"), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	if _, err := ReadReportKey(short); err == nil {
+		t.Error("ReadReportKey accepted a short key")
+	}
+}
@@ -0,0 +1,47 @@
+package phonehome
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxRevocationListSize bounds the revocation list download
+const maxRevocationListSize = 4 << 20
+
+// FetchRevocationList downloads the signed revocation list JWT from the
+// license server. The caller verifies it.
+func (c *Client) FetchRevocationList(ctx context.Context, serverURL string) (string, error) {
+	if c.httpClient == nil {
+		return "", fmt.Errorf("revocation list cannot be fetched in offline mode")
+	}
+	if serverURL == "" {
+		return "", fmt.Errorf("no license server URL configured")
+	}
+
+	url := fmt.Sprintf("%s/api/v1/revocations", serverURL)
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Accept", "application/jwt")
+	httpReq.Header.Set("User-Agent", "es-license-validator/1.0")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("server returned error status: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRevocationListSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to read revocation list: %w", err)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
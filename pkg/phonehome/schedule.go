@@ -0,0 +1,245 @@
+package phonehome
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/enterprisesight/es-license-validator/pkg/license"
+)
+
+// Schedule is the effective phone home configuration for one license
+type Schedule struct {
+	Enabled   bool
+	ServerURL string
+	Interval  time.Duration
+	Source    string // "license", "config", "license+config" or "server"
+}
+
+// ResolveSchedule merges the license's phone_home claim with the validator's
+// configuration. Each setting the license specifies (enabled, url,
+// interval_hours) overrides the corresponding configured value; unset
+// settings fall back to configuration.
+func ResolveSchedule(lic *license.License, enabled bool, serverURL string, interval time.Duration) Schedule {
+	schedule := Schedule{
+		Enabled:   enabled,
+		ServerURL: serverURL,
+		Interval:  interval,
+		Source:    "config",
+	}
+	if lic == nil {
+		return schedule
+	}
+
+	fromLicense, fromConfig := false, false
+	claim := lic.PhoneHomeConfig
+
+	if claim.Enabled != nil {
+		schedule.Enabled = *claim.Enabled
+		fromLicense = true
+	} else {
+		fromConfig = true
+	}
+	if claim.URL != "" {
+		schedule.ServerURL = claim.URL
+		fromLicense = true
+	} else {
+		fromConfig = true
+	}
+	if claim.IntervalHours > 0 {
+		schedule.Interval = time.Duration(claim.IntervalHours) * time.Hour
+		fromLicense = true
+	} else {
+		fromConfig = true
+	}
+
+	switch {
+	case fromLicense && fromConfig:
+		schedule.Source = "license+config"
+	case fromLicense:
+		schedule.Source = "license"
+	}
+	return schedule
+}
+
+// Scheduler tracks when each license last phoned home and is next due. The
+// last phone home times are stored as a JSON file, so a restart does not
+// report every license again; an empty path keeps them in memory only.
+type Scheduler struct {
+	path string
+
+	mu       sync.Mutex
+	state    map[string]*scheduleState
+	lastAt   map[string]time.Time // last phone home, kept for licenses no longer tracked
+	checkIns map[string]CheckIn   // server-pushed parameters, keyed by license ID
+}
+
+type scheduleState struct {
+	schedule Schedule
+	nextAt   time.Time
+}
+
+// ScheduleStatus reports the schedule of one license for the status endpoint
+type ScheduleStatus struct {
+	Schedule
+	LastAt time.Time // zero if never sent
+	NextAt time.Time // zero if disabled
+}
+
+// OpenScheduler opens the scheduler state at path, loading the last phone
+// home times from a previous run
+func OpenScheduler(path string) (*Scheduler, error) {
+	s := &Scheduler{
+		path:     path,
+		state:    make(map[string]*scheduleState),
+		lastAt:   make(map[string]time.Time),
+		checkIns: make(map[string]CheckIn),
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create phone home state directory: %w", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read phone home state: %w", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &s.lastAt); err != nil {
+			return nil, fmt.Errorf("failed to parse phone home state: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// SetCheckIn records check-in parameters pushed by the license server for a
+// license. They take precedence over both the license claim and configuration.
+func (s *Scheduler) SetCheckIn(licenseID string, checkIn CheckIn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkIns[licenseID] = checkIn
+}
+
+// ApplyCheckIn overrides a schedule with the server-pushed parameters for a
+// license, if any
+func (s *Scheduler) ApplyCheckIn(licenseID string, schedule Schedule) Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	checkIn, ok := s.checkIns[licenseID]
+	if !ok {
+		return schedule
+	}
+	if checkIn.Enabled != nil {
+		schedule.Enabled = *checkIn.Enabled
+	}
+	if checkIn.URL != "" {
+		schedule.ServerURL = checkIn.URL
+	}
+	if checkIn.IntervalHours > 0 {
+		schedule.Interval = time.Duration(checkIn.IntervalHours) * time.Hour
+	}
+	schedule.Source = "server"
+	return schedule
+}
+
+// Due reports whether the license identified by key should phone home now,
+// updating its schedule and saving the time when it is due. A license that
+// has never phoned home is due immediately; a shorter interval takes effect
+// from the last report.
+func (s *Scheduler) Due(key string, schedule Schedule, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.state[key]
+	if !ok {
+		st = &scheduleState{}
+		s.state[key] = st
+	}
+	st.schedule = schedule
+
+	if !schedule.Enabled || schedule.Interval <= 0 {
+		st.nextAt = time.Time{}
+		return false
+	}
+
+	if lastAt, ok := s.lastAt[key]; ok {
+		st.nextAt = lastAt.Add(schedule.Interval)
+	} else {
+		st.nextAt = now
+	}
+	if now.Before(st.nextAt) {
+		return false
+	}
+
+	s.lastAt[key] = now
+	st.nextAt = now.Add(schedule.Interval)
+	if err := s.save(); err != nil {
+		// The report is still sent; a restart may only report it early
+		slog.Warn("Failed to save phone home state", "path", s.path, "error", err)
+	}
+	return true
+}
+
+// Retain drops schedules for licenses not in keys. Their last phone home
+// times are kept, so a license that reappears is not reported early.
+func (s *Scheduler) Retain(keys []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keep := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		keep[key] = true
+	}
+	for key := range s.state {
+		if !keep[key] {
+			delete(s.state, key)
+		}
+	}
+}
+
+// Status returns the schedule of every tracked license
+func (s *Scheduler) Status() map[string]ScheduleStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string]ScheduleStatus, len(s.state))
+	for key, st := range s.state {
+		out[key] = ScheduleStatus{
+			Schedule: st.schedule,
+			LastAt:   s.lastAt[key],
+			NextAt:   st.nextAt,
+		}
+	}
+	return out
+}
+
+// save writes the last phone home times to the state file. Callers must hold
+// s.mu.
+func (s *Scheduler) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(s.lastAt)
+	if err != nil {
+		return fmt.Errorf("failed to marshal phone home state: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write phone home state: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace phone home state: %w", err)
+	}
+	return nil
+}
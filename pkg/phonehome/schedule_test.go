@@ -0,0 +1,170 @@
+package phonehome
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/enterprisesight/es-license-validator/pkg/license"
+)
+
+func TestResolveSchedule(t *testing.T) {
+	enabled, disabled := true, false
+
+	tests := []struct {
+		name  string
+		claim *license.PhoneHomeConfig // nil for no license
+		want  Schedule
+	}{
+		{
+			name: "no license",
+			want: Schedule{Enabled: true, ServerURL: "https://config.example", Interval: 24 * time.Hour, Source: "config"},
+		},
+		{
+			name:  "license without phone_home claim",
+			claim: &license.PhoneHomeConfig{},
+			want:  Schedule{Enabled: true, ServerURL: "https://config.example", Interval: 24 * time.Hour, Source: "config"},
+		},
+		{
+			name:  "license overrides everything",
+			claim: &license.PhoneHomeConfig{Enabled: &enabled, URL: "https://license.example", IntervalHours: 6},
+			want:  Schedule{Enabled: true, ServerURL: "https://license.example", Interval: 6 * time.Hour, Source: "license"},
+		},
+		{
+			name:  "license overrides the interval only",
+			claim: &license.PhoneHomeConfig{IntervalHours: 12},
+			want:  Schedule{Enabled: true, ServerURL: "https://config.example", Interval: 12 * time.Hour, Source: "license+config"},
+		},
+		{
+			name:  "license disables phone home",
+			claim: &license.PhoneHomeConfig{Enabled: &disabled},
+			want:  Schedule{Enabled: false, ServerURL: "https://config.example", Interval: 24 * time.Hour, Source: "license+config"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lic *license.License
+			if tt.claim != nil {
+				lic = &license.License{PhoneHomeConfig: *tt.claim}
+			}
+			if got := ResolveSchedule(lic, true, "https://config.example", 24*time.Hour); got != tt.want {
+				t.Errorf("schedule = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchedulerDue(t *testing.T) {
+	start := time.Date(2025, 10, 21, 12, 0, 0, 0, time.UTC)
+	daily := Schedule{Enabled: true, Interval: 24 * time.Hour}
+
+	steps := []struct {
+		at       time.Duration // since start
+		schedule Schedule
+		due      bool
+	}{
+		{at: 0, schedule: daily, due: true}, // never sent
+		{at: time.Hour, schedule: daily, due: false},
+		{at: 24 * time.Hour, schedule: daily, due: true},
+		{at: 25 * time.Hour, schedule: Schedule{Enabled: true, Interval: time.Hour}, due: true}, // shorter interval counts from the last report
+		{at: 25*time.Hour + 30*time.Minute, schedule: Schedule{Enabled: true, Interval: time.Hour}, due: false},
+		{at: 48 * time.Hour, schedule: Schedule{Enabled: false, Interval: time.Hour}, due: false},
+		{at: 49 * time.Hour, schedule: Schedule{Enabled: true}, due: false}, // no interval
+	}
+
+	scheduler := mustOpenScheduler(t)
+	for i, step := range steps {
+		if due := scheduler.Due("lic-1", step.schedule, start.Add(step.at)); due != step.due {
+			t.Errorf("step %d at +%s: due = %v, want %v", i, step.at, due, step.due)
+		}
+	}
+
+	status := scheduler.Status()["lic-1"]
+	if !status.LastAt.Equal(start.Add(25*time.Hour)) || !status.NextAt.IsZero() {
+		t.Errorf("status = %+v, want last report at +25h and no next report", status)
+	}
+}
+
+// mustOpenScheduler opens a scheduler keeping its state in memory
+func mustOpenScheduler(t *testing.T) *Scheduler {
+	t.Helper()
+	scheduler, err := OpenScheduler("")
+	if err != nil {
+		t.Fatalf("OpenScheduler: %v", err)
+	}
+	return scheduler
+}
+
+func TestSchedulerRetain(t *testing.T) {
+	now := time.Now()
+	scheduler := mustOpenScheduler(t)
+	scheduler.Due("lic-1", Schedule{Enabled: true, Interval: time.Hour}, now)
+	scheduler.Due("lic-2", Schedule{Enabled: true, Interval: time.Hour}, now)
+
+	scheduler.Retain([]string{"lic-2"})
+	if status := scheduler.Status(); len(status) != 1 || status["lic-2"].LastAt.IsZero() {
+		t.Errorf("status = %+v, want lic-2 only", status)
+	}
+
+	// A license that comes back keeps its last report time
+	if scheduler.Due("lic-1", Schedule{Enabled: true, Interval: time.Hour}, now.Add(time.Minute)) {
+		t.Error("retained-out license due again before its interval")
+	}
+}
+
+func TestSchedulerPersistsLastReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "phone-home.json")
+	start := time.Date(2025, 10, 21, 0, 0, 0, 0, time.UTC)
+	daily := Schedule{Enabled: true, Interval: 24 * time.Hour}
+
+	scheduler, err := OpenScheduler(path)
+	if err != nil {
+		t.Fatalf("OpenScheduler: %v", err)
+	}
+	if !scheduler.Due("lic-1", daily, start) {
+		t.Fatal("first report not due")
+	}
+
+	// After a restart the license is not reported again before its interval
+	restarted, err := OpenScheduler(path)
+	if err != nil {
+		t.Fatalf("OpenScheduler after restart: %v", err)
+	}
+	if restarted.Due("lic-1", daily, start.Add(time.Hour)) {
+		t.Error("license reported again right after a restart")
+	}
+	if status := restarted.Status()["lic-1"]; !status.LastAt.Equal(start) || !status.NextAt.Equal(start.Add(24*time.Hour)) {
+		t.Errorf("status after restart = %+v, want last report at start", status)
+	}
+	if !restarted.Due("lic-1", daily, start.Add(24*time.Hour)) {
+		t.Error("license not due after its interval")
+	}
+	if !restarted.Due("lic-2", daily, start.Add(time.Hour)) {
+		t.Error("new license not due immediately")
+	}
+}
+
+func TestSchedulerApplyCheckIn(t *testing.T) {
+	disabled := false
+	configured := Schedule{Enabled: true, ServerURL: "https://config.example", Interval: 24 * time.Hour, Source: "config"}
+
+	scheduler := mustOpenScheduler(t)
+	if got := scheduler.ApplyCheckIn("lic-1", configured); got != configured {
+		t.Errorf("without check-in: schedule = %+v, want it unchanged", got)
+	}
+
+	scheduler.SetCheckIn("lic-1", CheckIn{URL: "https://server.example", IntervalHours: 1})
+	want := Schedule{Enabled: true, ServerURL: "https://server.example", Interval: time.Hour, Source: "server"}
+	if got := scheduler.ApplyCheckIn("lic-1", configured); got != want {
+		t.Errorf("with check-in: schedule = %+v, want %+v", got, want)
+	}
+	if got := scheduler.ApplyCheckIn("lic-2", configured); got != configured {
+		t.Errorf("other license: schedule = %+v, want it unchanged", got)
+	}
+
+	scheduler.SetCheckIn("lic-1", CheckIn{Enabled: &disabled})
+	if got := scheduler.ApplyCheckIn("lic-1", configured); got.Enabled || got.Interval != 24*time.Hour {
+		t.Errorf("disabling check-in: schedule = %+v", got)
+	}
+}
@@ -0,0 +1,240 @@
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/enterprisesight/es-license-validator/pkg/license"
+)
+
+// Action is what enforcement does about a failure
+type Action string
+
+const (
+	Allow Action = "allow" // ignore the failure
+	Warn  Action = "warn"  // stay ready, but report a warning
+	Block Action = "block" // report not ready
+)
+
+// FailureMode is a class of validation failure governed by the policy
+type FailureMode string
+
+const (
+	NodeOverage       FailureMode = "node_overage"
+	Overage           FailureMode = "overage" // above licensed_nodes but within max_nodes
+	CapacityOverage   FailureMode = "capacity_overage"
+	Expiry            FailureMode = "expiry"
+	NamespaceMismatch FailureMode = "namespace_mismatch"
+	SecretUnreadable  FailureMode = "secret_unreadable"
+	APIUnreachable    FailureMode = "api_unreachable"
+
+	// Invalid covers failures the policy cannot relax, such as a bad
+	// signature, a revoked license or a missing license; always blocked
+	Invalid FailureMode = "invalid"
+)
+
+// Modes lists the failure modes the policy can configure
+var Modes = []FailureMode{NodeOverage, Overage, CapacityOverage, Expiry, NamespaceMismatch, SecretUnreadable, APIUnreachable}
+
+// Policy maps each failure mode to an action
+type Policy struct {
+	actions map[FailureMode]Action
+	// expirySet records an explicit expiry override, which then also
+	// decides the grace period
+	expirySet bool
+}
+
+// Default returns the policy implied by FAIL_OPEN. Fail-open warns about
+// infrastructure failures (Secret unreadable, API server unreachable);
+// license violations block. Fail-closed blocks on every failure. Either way,
+// an expired license only warns during the grace period it grants, and
+// overage within max_nodes is allowed and only reported for billing.
+func Default(failOpen bool) *Policy {
+	p := &Policy{actions: make(map[FailureMode]Action, len(Modes))}
+	for _, mode := range Modes {
+		p.actions[mode] = Block
+	}
+	p.actions[Overage] = Allow
+	if failOpen {
+		p.actions[SecretUnreadable] = Warn
+		p.actions[APIUnreachable] = Warn
+	}
+	return p
+}
+
+// Parse applies overrides of the form "node_overage=warn,expiry=block" to the
+// default policy for failOpen
+func Parse(spec string, failOpen bool) (*Policy, error) {
+	p := Default(failOpen)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		mode, action, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid policy entry %q: expected mode=action", entry)
+		}
+
+		m := FailureMode(strings.TrimSpace(mode))
+		if _, known := p.actions[m]; !known {
+			return nil, fmt.Errorf("unknown failure mode %q", m)
+		}
+		a := Action(strings.TrimSpace(action))
+		if a != Allow && a != Warn && a != Block {
+			return nil, fmt.Errorf("invalid action %q for %s: expected allow, warn or block", a, m)
+		}
+		p.actions[m] = a
+		if m == Expiry {
+			p.expirySet = true
+		}
+	}
+	return p, nil
+}
+
+// Actions returns the configured action for each failure mode
+func (p *Policy) Actions() map[FailureMode]Action {
+	actions := make(map[FailureMode]Action, len(p.actions))
+	for mode, action := range p.actions {
+		actions[mode] = action
+	}
+	return actions
+}
+
+// String returns the policy in the form accepted by Parse
+func (p *Policy) String() string {
+	entries := make([]string, 0, len(p.actions))
+	for mode, action := range p.actions {
+		entries = append(entries, fmt.Sprintf("%s=%s", mode, action))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+// Violation is a failure found in a validation result and the action taken
+type Violation struct {
+	Mode    FailureMode
+	Action  Action
+	Message string
+}
+
+// Decision is the outcome of applying the policy to a validation result
+type Decision struct {
+	Action     Action // the strictest action of all violations
+	Violations []Violation
+}
+
+// Allowed reports whether the product may run
+func (d Decision) Allowed() bool {
+	return d.Action != Block
+}
+
+// Warnings returns the messages of violations that only warn
+func (d Decision) Warnings() []string {
+	var warnings []string
+	for _, v := range d.Violations {
+		if v.Action == Warn {
+			warnings = append(warnings, v.Message)
+		}
+	}
+	return warnings
+}
+
+func (d *Decision) add(mode FailureMode, action Action, message string) {
+	d.Violations = append(d.Violations, Violation{Mode: mode, Action: action, Message: message})
+	if severity(action) > severity(d.Action) {
+		d.Action = action
+	}
+}
+
+// Evaluate applies the policy to a license as a whole
+func (p *Policy) Evaluate(result *license.ValidationResult) Decision {
+	return p.evaluate(result, result.Products)
+}
+
+// EvaluateProduct applies the policy to one product of a license, so only
+// that product's node count and capacity matter
+func (p *Policy) EvaluateProduct(result *license.ValidationResult, productCode string) Decision {
+	product, ok := result.Product(productCode)
+	if !ok {
+		return p.Evaluate(result)
+	}
+	return p.evaluate(result, []license.ProductResult{*product})
+}
+
+func (p *Policy) evaluate(result *license.ValidationResult, products []license.ProductResult) Decision {
+	decision := Decision{Action: Allow}
+
+	if result.SecretUnreadable {
+		decision.add(SecretUnreadable, p.actions[SecretUnreadable], errorMessage(result, "license secret could not be read"))
+		return decision
+	}
+	if result.License == nil || !result.SignatureValid || result.Revoked || !result.NotBeforeValid {
+		decision.add(Invalid, Block, errorMessage(result, "license is invalid"))
+		return decision
+	}
+
+	if !result.ExpiryValid {
+		action := p.actions[Expiry]
+		message := "license has expired"
+		if result.IsInGracePeriod {
+			// The grace period the license grants only warns, unless
+			// expiry is overridden explicitly
+			if !p.expirySet && severity(action) > severity(Warn) {
+				action = Warn
+			}
+			message = fmt.Sprintf("license expired %d days ago and is in its grace period", -result.DaysUntilExpiry)
+		}
+		decision.add(Expiry, action, message)
+	}
+
+	if !result.NamespaceValid {
+		decision.add(NamespaceMismatch, p.actions[NamespaceMismatch],
+			fmt.Sprintf("license is for namespace %q but validator is running in %q", result.LicenseNamespace, result.ActualNamespace))
+	}
+
+	if result.NodeCountUnavailable {
+		decision.add(APIUnreachable, p.actions[APIUnreachable], errorMessage(result, "nodes could not be counted"))
+		return decision
+	}
+	for _, product := range products {
+		for _, dimension := range product.Dimensions {
+			switch {
+			case dimension.Overage:
+				decision.add(Overage, p.actions[Overage], fmt.Sprintf("%s %s (%g) exceeds licensed %s (%g) and is billed as overage up to max %s (%g)",
+					product.ProductCode, dimension.Dimension, dimension.Used, dimension.Dimension, dimension.Licensed, dimension.Dimension, dimension.Max))
+			case !dimension.Valid && dimension.Max > 0:
+				decision.add(NodeOverage, p.actions[NodeOverage], fmt.Sprintf("%s %s (%g) exceeds max %s (%g)",
+					product.ProductCode, dimension.Dimension, dimension.Used, dimension.Dimension, dimension.Max))
+			case !dimension.Valid:
+				mode := CapacityOverage
+				if dimension.Dimension == license.DimensionNodes {
+					mode = NodeOverage
+				}
+				decision.add(mode, p.actions[mode], fmt.Sprintf("%s %s (%g) exceeds licensed %s (%g)",
+					product.ProductCode, dimension.Dimension, dimension.Used, dimension.Dimension, dimension.Licensed))
+			}
+		}
+	}
+
+	return decision
+}
+
+func errorMessage(result *license.ValidationResult, fallback string) string {
+	if result.Error != nil {
+		return result.Error.Error()
+	}
+	return fallback
+}
+
+func severity(action Action) int {
+	switch action {
+	case Warn:
+		return 1
+	case Block:
+		return 2
+	}
+	return 0
+}
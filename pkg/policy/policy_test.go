@@ -0,0 +1,291 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/enterprisesight/es-license-validator/pkg/license"
+)
+
+// validResult returns a result for a valid license of one product
+func validResult() *license.ValidationResult {
+	return &license.ValidationResult{
+		Valid:           true,
+		License:         &license.License{LicenseID: "lic-1"},
+		SignatureValid:  true,
+		ExpiryValid:     true,
+		NotBeforeValid:  true,
+		NamespaceValid:  true,
+		NodeCountValid:  true,
+		CapacityValid:   true,
+		DaysUntilExpiry: 30,
+		Products: []license.ProductResult{{
+			ProductCode:    "es-core-gw",
+			NodeCount:      3,
+			LicensedNodes:  3,
+			NodeCountValid: true,
+			Valid:          true,
+			CapacityValid:  true,
+			Dimensions: []license.DimensionResult{
+				{Dimension: license.DimensionNodes, Used: 3, Licensed: 3, Valid: true},
+			},
+		}},
+	}
+}
+
+// withDimension replaces the product's dimensions with d
+func withDimension(d license.DimensionResult) func(*license.ValidationResult) {
+	return func(r *license.ValidationResult) {
+		r.Products[0].Dimensions = []license.DimensionResult{d}
+	}
+}
+
+func TestEvaluateFailureModes(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*license.ValidationResult)
+		mode   FailureMode // empty for no violation
+		open   Action      // action with FAIL_OPEN=true
+		closed Action      // action with FAIL_OPEN=false
+	}{
+		{
+			name:   "valid",
+			mutate: func(*license.ValidationResult) {},
+			open:   Allow,
+			closed: Allow,
+		},
+		{
+			name:   "bad signature",
+			mutate: func(r *license.ValidationResult) { r.SignatureValid = false },
+			mode:   Invalid,
+			open:   Block,
+			closed: Block,
+		},
+		{
+			name:   "revoked",
+			mutate: func(r *license.ValidationResult) { r.Revoked = true },
+			mode:   Invalid,
+			open:   Block,
+			closed: Block,
+		},
+		{
+			name:   "not yet valid",
+			mutate: func(r *license.ValidationResult) { r.NotBeforeValid = false },
+			mode:   Invalid,
+			open:   Block,
+			closed: Block,
+		},
+		{
+			name: "missing license",
+			mutate: func(r *license.ValidationResult) {
+				r.License = nil
+				r.Error = errors.New("license secret not found")
+			},
+			mode:   Invalid,
+			open:   Block,
+			closed: Block,
+		},
+		{
+			name:   "secret unreadable",
+			mutate: func(r *license.ValidationResult) { r.SecretUnreadable = true },
+			mode:   SecretUnreadable,
+			open:   Warn,
+			closed: Block,
+		},
+		{
+			name:   "api unreachable",
+			mutate: func(r *license.ValidationResult) { r.NodeCountUnavailable = true },
+			mode:   APIUnreachable,
+			open:   Warn,
+			closed: Block,
+		},
+		{
+			name: "expired",
+			mutate: func(r *license.ValidationResult) {
+				r.ExpiryValid = false
+				r.DaysUntilExpiry = -3
+			},
+			mode:   Expiry,
+			open:   Block,
+			closed: Block,
+		},
+		{
+			name: "expired in grace period",
+			mutate: func(r *license.ValidationResult) {
+				r.ExpiryValid = false
+				r.DaysUntilExpiry = -3
+				r.IsInGracePeriod = true
+			},
+			mode:   Expiry,
+			open:   Warn,
+			closed: Warn,
+		},
+		{
+			name: "namespace mismatch",
+			mutate: func(r *license.ValidationResult) {
+				r.NamespaceValid = false
+				r.LicenseNamespace = "es-core"
+				r.ActualNamespace = "default"
+			},
+			mode:   NamespaceMismatch,
+			open:   Block,
+			closed: Block,
+		},
+		{
+			name:   "nodes above licensed_nodes without max_nodes",
+			mutate: withDimension(license.DimensionResult{Dimension: license.DimensionNodes, Used: 4, Licensed: 3}),
+			mode:   NodeOverage,
+			open:   Block,
+			closed: Block,
+		},
+		{
+			name:   "nodes within max_nodes",
+			mutate: withDimension(license.DimensionResult{Dimension: license.DimensionNodes, Used: 4, Licensed: 3, Max: 5, Valid: true, Overage: true}),
+			mode:   Overage,
+			open:   Allow,
+			closed: Allow,
+		},
+		{
+			name:   "nodes above max_nodes",
+			mutate: withDimension(license.DimensionResult{Dimension: license.DimensionNodes, Used: 6, Licensed: 3, Max: 5}),
+			mode:   NodeOverage,
+			open:   Block,
+			closed: Block,
+		},
+		{
+			name:   "vcpus above licensed",
+			mutate: withDimension(license.DimensionResult{Dimension: license.DimensionVCPUs, Used: 40, Licensed: 32}),
+			mode:   CapacityOverage,
+			open:   Block,
+			closed: Block,
+		},
+	}
+
+	for _, tt := range tests {
+		for _, failOpen := range []bool{true, false} {
+			want := tt.closed
+			if failOpen {
+				want = tt.open
+			}
+
+			result := validResult()
+			tt.mutate(result)
+			decision := Default(failOpen).Evaluate(result)
+
+			if decision.Action != want {
+				t.Errorf("%s, fail-open %v: action = %s, want %s (%+v)", tt.name, failOpen, decision.Action, want, decision.Violations)
+			}
+			if decision.Allowed() != (want != Block) {
+				t.Errorf("%s, fail-open %v: allowed = %v", tt.name, failOpen, decision.Allowed())
+			}
+			if tt.mode == "" {
+				if len(decision.Violations) != 0 {
+					t.Errorf("%s, fail-open %v: unexpected violations %+v", tt.name, failOpen, decision.Violations)
+				}
+				continue
+			}
+			if !hasViolation(decision, tt.mode, want) {
+				t.Errorf("%s, fail-open %v: no %s=%s violation in %+v", tt.name, failOpen, tt.mode, want, decision.Violations)
+			}
+			if want == Warn && len(decision.Warnings()) == 0 {
+				t.Errorf("%s, fail-open %v: warning not reported", tt.name, failOpen)
+			}
+		}
+	}
+}
+
+func TestParseOverrides(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		failOpen bool
+		mutate   func(*license.ValidationResult)
+		want     Action
+		wantErr  bool
+	}{
+		{
+			name:     "warn on node overage",
+			spec:     "node_overage=warn",
+			failOpen: false,
+			mutate:   withDimension(license.DimensionResult{Dimension: license.DimensionNodes, Used: 4, Licensed: 3}),
+			want:     Warn,
+		},
+		{
+			name:     "block on unreachable API server despite fail-open",
+			spec:     "api_unreachable=block",
+			failOpen: true,
+			mutate:   func(r *license.ValidationResult) { r.NodeCountUnavailable = true },
+			want:     Block,
+		},
+		{
+			name:     "allow expiry outright",
+			spec:     "expiry=allow",
+			failOpen: true,
+			mutate: func(r *license.ValidationResult) {
+				r.ExpiryValid = false
+				r.IsInGracePeriod = true
+			},
+			want: Allow,
+		},
+		{
+			name:     "block expiry during the grace period",
+			spec:     "expiry=block",
+			failOpen: true,
+			mutate: func(r *license.ValidationResult) {
+				r.ExpiryValid = false
+				r.IsInGracePeriod = true
+			},
+			want: Block,
+		},
+		{
+			name:    "invalid cannot be relaxed",
+			spec:    "invalid=allow",
+			wantErr: true,
+		},
+		{
+			name:    "unknown mode",
+			spec:    "tampering=allow",
+			wantErr: true,
+		},
+		{
+			name:    "unknown action",
+			spec:    "expiry=ignore",
+			wantErr: true,
+		},
+		{
+			name:    "missing action",
+			spec:    "expiry",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse(tt.spec, tt.failOpen)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Parse(%q) succeeded, want an error", tt.spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.spec, err)
+			}
+
+			result := validResult()
+			tt.mutate(result)
+			if got := p.Evaluate(result).Action; got != tt.want {
+				t.Errorf("action = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func hasViolation(decision Decision, mode FailureMode, action Action) bool {
+	for _, v := range decision.Violations {
+		if v.Mode == mode && v.Action == action {
+			return true
+		}
+	}
+	return false
+}
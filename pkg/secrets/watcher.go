@@ -0,0 +1,174 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Watcher watches a single Kubernetes Secret by name
+type Watcher struct {
+	namespace string
+	name      string
+	informer  cache.SharedIndexInformer
+	lister    listersv1.SecretLister
+
+	// Health of the Secret watch. The cache keeps serving the last known
+	// Secret while the API server refuses or fails list and watch calls, so
+	// failures are tracked to report the Secret as unreadable instead.
+	mu               sync.Mutex
+	failingSince     time.Time
+	lastError        error
+	failureTolerance time.Duration
+}
+
+// watchFailureTolerance is how long the Secret watch may keep failing before
+// a previously synced Secret is reported as unreadable
+const watchFailureTolerance = time.Minute
+
+// syncPollInterval is how often Start checks for a failed initial sync
+const syncPollInterval = 100 * time.Millisecond
+
+// NewWatcher creates a watcher scoped to the named Secret
+func NewWatcher(clientset kubernetes.Interface, namespace, name string) (*Watcher, error) {
+	w := &Watcher{
+		namespace:        namespace,
+		name:             name,
+		failureTolerance: watchFailureTolerance,
+	}
+
+	// Watch only the named Secret, recording the outcome of every list and
+	// watch call
+	secrets := clientset.CoreV1().Secrets(namespace)
+	fieldSelector := fields.OneTermEqualSelector("metadata.name", name).String()
+	w.informer = cache.NewSharedIndexInformer(&cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			opts.FieldSelector = fieldSelector
+			list, err := secrets.List(context.Background(), opts)
+			w.observe(err)
+			return list, err
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			opts.FieldSelector = fieldSelector
+			watcher, err := secrets.Watch(context.Background(), opts)
+			w.observe(err)
+			return watcher, err
+		},
+	}, &corev1.Secret{}, 0, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	if err := w.informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+		cache.DefaultWatchErrorHandler(r, err)
+		w.observe(err)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to set secret watch error handler: %w", err)
+	}
+	w.lister = listersv1.NewSecretLister(w.informer.GetIndexer())
+
+	return w, nil
+}
+
+// observe records the outcome of a Secret list or watch call
+func (w *Watcher) observe(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err == nil {
+		w.failingSince = time.Time{}
+		w.lastError = nil
+		return
+	}
+	if w.failingSince.IsZero() {
+		w.failingSince = time.Now()
+	}
+	w.lastError = err
+}
+
+// checkWatch returns an error while the Secret cannot be read from the API
+// server: at once before the first sync, as there is no cached Secret yet,
+// and after watchFailureTolerance once synced, as the cached Secret may then
+// be stale
+func (w *Watcher) checkWatch() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.failingSince.IsZero() {
+		return nil
+	}
+	if w.informer.HasSynced() && time.Since(w.failingSince) < w.failureTolerance {
+		return nil
+	}
+	return fmt.Errorf("secret watch failing since %s: %w", w.failingSince.Format(time.RFC3339), w.lastError)
+}
+
+// OnChange registers a callback invoked whenever the Secret is created,
+// deleted or its data is updated. Must be called before Start.
+func (w *Watcher) OnChange(fn func()) error {
+	_, err := w.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			fn()
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldSecret, okOld := oldObj.(*corev1.Secret)
+			newSecret, okNew := newObj.(*corev1.Secret)
+			// Ignore metadata-only updates, such as status annotations
+			if okOld && okNew && reflect.DeepEqual(oldSecret.Data, newSecret.Data) {
+				return
+			}
+			fn()
+		},
+		DeleteFunc: func(obj interface{}) {
+			fn()
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add secret event handler: %w", err)
+	}
+	return nil
+}
+
+// Start starts the Secret informer and waits for its cache to sync. When the
+// Secret cannot be listed, e.g. for lack of RBAC permissions, Start returns
+// without waiting; the informer keeps retrying and Get reports the error
+// until it syncs.
+func (w *Watcher) Start(ctx context.Context) error {
+	go w.informer.Run(ctx.Done())
+
+	ticker := time.NewTicker(syncPollInterval)
+	defer ticker.Stop()
+	for !w.informer.HasSynced() {
+		if err := w.checkWatch(); err != nil {
+			slog.Warn("License secret watch has not synced", "secret", w.name, "namespace", w.namespace, "error", err)
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to sync secret cache")
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// Get returns the current Secret from the watch cache. A missing Secret
+// returns a NotFound error; a Secret that cannot be read from the API server
+// returns the list or watch error.
+func (w *Watcher) Get() (*corev1.Secret, error) {
+	if err := w.checkWatch(); err != nil {
+		return nil, err
+	}
+	if !w.informer.HasSynced() {
+		return nil, fmt.Errorf("secret watch has not synced")
+	}
+	return w.lister.Secrets(w.namespace).Get(w.name)
+}
@@ -0,0 +1,114 @@
+package secrets
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// licenseSecret is the watched Secret
+var licenseSecret = &corev1.Secret{
+	ObjectMeta: metav1.ObjectMeta{Name: "es-license", Namespace: "es-core"},
+	Data:       map[string][]byte{"license.jwt": []byte("token")},
+}
+
+// forbidden makes every Secret list and watch call fail as for missing RBAC
+func forbidden(clientset *fake.Clientset) {
+	reactor := func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "", nil)
+	}
+	clientset.PrependReactor("list", "secrets", reactor)
+	clientset.PrependWatchReactor("secrets", func(k8stesting.Action) (bool, watch.Interface, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "", nil)
+	})
+}
+
+// startWatcher starts a watcher on clientset, failing if Start blocks
+func startWatcher(t *testing.T, clientset *fake.Clientset) *Watcher {
+	t.Helper()
+	w, err := NewWatcher(clientset, "es-core", "es-license")
+	if err != nil {
+		t.Fatalf("NewWatcher: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	if err := w.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	return w
+}
+
+func TestWatcherGet(t *testing.T) {
+	tests := []struct {
+		name      string
+		objects   []runtime.Object
+		forbidden bool
+		check     func(*corev1.Secret, error) bool
+	}{
+		{
+			name:    "secret present",
+			objects: []runtime.Object{licenseSecret},
+			check:   func(s *corev1.Secret, err error) bool { return err == nil && string(s.Data["license.jwt"]) == "token" },
+		},
+		{
+			name:  "secret missing",
+			check: func(_ *corev1.Secret, err error) bool { return apierrors.IsNotFound(err) },
+		},
+		{
+			name:      "secret list forbidden",
+			objects:   []runtime.Object{licenseSecret},
+			forbidden: true,
+			check: func(_ *corev1.Secret, err error) bool {
+				return apierrors.IsForbidden(err) && !apierrors.IsNotFound(err)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(tt.objects...)
+			if tt.forbidden {
+				forbidden(clientset)
+			}
+			w := startWatcher(t, clientset)
+
+			secret, err := w.Get()
+			if !tt.check(secret, err) {
+				t.Errorf("Get() = %v, %v", secret, err)
+			}
+		})
+	}
+}
+
+func TestWatcherReportsFailingWatchAfterTolerance(t *testing.T) {
+	w := startWatcher(t, fake.NewSimpleClientset(licenseSecret))
+	failure := apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "", nil)
+
+	// A brief failure keeps serving the cached Secret
+	w.observe(failure)
+	if _, err := w.Get(); err != nil {
+		t.Fatalf("Get() within the failure tolerance: %v", err)
+	}
+
+	w.mu.Lock()
+	w.failureTolerance = 0
+	w.mu.Unlock()
+	if _, err := w.Get(); !apierrors.IsForbidden(err) {
+		t.Errorf("Get() after the failure tolerance = %v, want the watch error", err)
+	}
+
+	w.observe(nil)
+	if _, err := w.Get(); err != nil {
+		t.Errorf("Get() after the watch recovered: %v", err)
+	}
+}
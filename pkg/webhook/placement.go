@@ -0,0 +1,243 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Placement modes
+const (
+	PlacementNodeSelector = "nodeSelector" // merge the selector into spec.nodeSelector
+	PlacementAffinity     = "affinity"     // add required node affinity terms
+)
+
+// maxReviewBytes bounds the size of an AdmissionReview request body
+const maxReviewBytes = 4 << 20
+
+// SelectorFunc returns the node labels pods of a product must be scheduled on
+type SelectorFunc func(product string) map[string]string
+
+// PlacementMutator is a mutating admission webhook that pins ES product pods
+// onto licensed nodes, so pod placement matches the nodes the license counts
+type PlacementMutator struct {
+	productLabel string
+	placement    string
+	selector     SelectorFunc
+}
+
+// NewPlacementMutator creates a webhook that mutates pods carrying
+// productLabel, using the selector returned for the label's value
+func NewPlacementMutator(productLabel, placement string, selector SelectorFunc) (*PlacementMutator, error) {
+	if productLabel == "" {
+		return nil, fmt.Errorf("product label must not be empty")
+	}
+	if placement != PlacementNodeSelector && placement != PlacementAffinity {
+		return nil, fmt.Errorf("invalid placement %q: expected %s or %s", placement, PlacementNodeSelector, PlacementAffinity)
+	}
+	return &PlacementMutator{
+		productLabel: productLabel,
+		placement:    placement,
+		selector:     selector,
+	}, nil
+}
+
+// patchOperation is a JSON Patch (RFC 6902) operation
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// ServeHTTP handles an AdmissionReview request
+func (m *PlacementMutator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxReviewBytes))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var review admissionv1.AdmissionReview
+	if err := json.Unmarshal(body, &review); err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode admission review: %v", err), http.StatusBadRequest)
+		return
+	}
+	if review.Request == nil {
+		http.Error(w, "admission review has no request", http.StatusBadRequest)
+		return
+	}
+
+	response := m.review(review.Request)
+	response.UID = review.Request.UID
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "admission.k8s.io/v1",
+			Kind:       "AdmissionReview",
+		},
+		Response: response,
+	})
+}
+
+// review decides the mutation for a single admission request. Pods are
+// always admitted; only their placement is changed.
+func (m *PlacementMutator) review(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	response := &admissionv1.AdmissionResponse{Allowed: true}
+	if req.Kind.Kind != "Pod" {
+		return response
+	}
+
+	var pod corev1.Pod
+	if err := json.Unmarshal(req.Object.Raw, &pod); err != nil {
+		slog.Error("Failed to decode pod for placement", "namespace", req.Namespace, "error", err)
+		return response
+	}
+
+	product := pod.Labels[m.productLabel]
+	if product == "" {
+		return response
+	}
+	selector := m.selector(product)
+	if len(selector) == 0 {
+		return response
+	}
+
+	var patch []patchOperation
+	switch m.placement {
+	case PlacementAffinity:
+		patch = affinityPatch(&pod, selector)
+	default:
+		patch = nodeSelectorPatch(&pod, selector)
+	}
+	if len(patch) == 0 {
+		return response
+	}
+
+	patchBytes, err := json.Marshal(patch)
+	if err != nil {
+		slog.Error("Failed to marshal placement patch", "product", product, "error", err)
+		return response
+	}
+
+	slog.Info("Pinned pod onto licensed nodes",
+		"product", product, "namespace", req.Namespace, "pod", podName(&pod),
+		"placement", m.placement, "node_selector", selector)
+
+	patchType := admissionv1.PatchTypeJSONPatch
+	response.Patch = patchBytes
+	response.PatchType = &patchType
+	return response
+}
+
+// nodeSelectorPatch merges the selector into the pod's nodeSelector. The
+// licensed labels win over conflicting values already on the pod.
+func nodeSelectorPatch(pod *corev1.Pod, selector map[string]string) []patchOperation {
+	merged := make(map[string]string, len(pod.Spec.NodeSelector)+len(selector))
+	for key, value := range pod.Spec.NodeSelector {
+		merged[key] = value
+	}
+
+	changed := false
+	for key, value := range selector {
+		if current, ok := merged[key]; ok && current == value {
+			continue
+		}
+		merged[key] = value
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
+	return []patchOperation{{Op: "add", Path: "/spec/nodeSelector", Value: merged}}
+}
+
+// affinityPatch requires the selector's labels in every required node
+// affinity term of the pod. Terms are ORed, so each one must carry them.
+func affinityPatch(pod *corev1.Pod, selector map[string]string) []patchOperation {
+	requirements := selectorRequirements(selector)
+
+	affinity := &corev1.Affinity{}
+	if pod.Spec.Affinity != nil {
+		affinity = pod.Spec.Affinity.DeepCopy()
+	}
+	if affinity.NodeAffinity == nil {
+		affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	required := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if required == nil {
+		required = &corev1.NodeSelector{}
+		affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = required
+	}
+	if len(required.NodeSelectorTerms) == 0 {
+		required.NodeSelectorTerms = []corev1.NodeSelectorTerm{{}}
+	}
+
+	changed := false
+	for i := range required.NodeSelectorTerms {
+		term := &required.NodeSelectorTerms[i]
+		for _, requirement := range requirements {
+			if hasRequirement(term.MatchExpressions, requirement) {
+				continue
+			}
+			term.MatchExpressions = append(term.MatchExpressions, requirement)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	return []patchOperation{{Op: "add", Path: "/spec/affinity", Value: affinity}}
+}
+
+// selectorRequirements converts a label selector into node selector
+// requirements, sorted by key for a stable patch
+func selectorRequirements(selector map[string]string) []corev1.NodeSelectorRequirement {
+	keys := make([]string, 0, len(selector))
+	for key := range selector {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	requirements := make([]corev1.NodeSelectorRequirement, 0, len(keys))
+	for _, key := range keys {
+		requirements = append(requirements, corev1.NodeSelectorRequirement{
+			Key:      key,
+			Operator: corev1.NodeSelectorOpIn,
+			Values:   []string{selector[key]},
+		})
+	}
+	return requirements
+}
+
+func hasRequirement(requirements []corev1.NodeSelectorRequirement, want corev1.NodeSelectorRequirement) bool {
+	for _, r := range requirements {
+		if r.Key == want.Key && r.Operator == want.Operator && len(r.Values) == 1 && r.Values[0] == want.Values[0] {
+			return true
+		}
+	}
+	return false
+}
+
+// podName names a pod for logging; pods created by controllers only have a
+// generateName at admission time
+func podName(pod *corev1.Pod) string {
+	if pod.Name != "" {
+		return pod.Name
+	}
+	return pod.GenerateName
+}
@@ -0,0 +1,228 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// licensedSelector licenses es-core-gw on pool=es nodes only
+func licensedSelector(product string) map[string]string {
+	if product == "es-core-gw" {
+		return map[string]string{"pool": "es"}
+	}
+	return nil
+}
+
+// admit sends pod to the mutator and returns the JSON patch applied, if any
+func admit(t *testing.T, mutator http.Handler, pod *corev1.Pod) []patchOperation {
+	t.Helper()
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatalf("failed to marshal pod: %v", err)
+	}
+	body, err := json.Marshal(admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:       "review-1",
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Namespace: "es-core",
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal review: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	mutator.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mutate", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+
+	var review admissionv1.AdmissionReview
+	if err := json.Unmarshal(rec.Body.Bytes(), &review); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if review.Response == nil || !review.Response.Allowed || review.Response.UID != "review-1" {
+		t.Fatalf("response = %+v, want review-1 allowed", review.Response)
+	}
+	if review.Response.Patch == nil {
+		return nil
+	}
+	var patch []patchOperation
+	if err := json.Unmarshal(review.Response.Patch, &patch); err != nil {
+		t.Fatalf("failed to decode patch: %v", err)
+	}
+	return patch
+}
+
+func productPod(product string, spec corev1.PodSpec) *corev1.Pod {
+	pod := &corev1.Pod{Spec: spec}
+	pod.GenerateName = "gateway-"
+	if product != "" {
+		pod.Labels = map[string]string{"es.io/product": product}
+	}
+	return pod
+}
+
+func TestPlacementNodeSelector(t *testing.T) {
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+		want map[string]string // nil for no patch
+	}{
+		{
+			name: "pod without nodeSelector",
+			pod:  productPod("es-core-gw", corev1.PodSpec{}),
+			want: map[string]string{"pool": "es"},
+		},
+		{
+			name: "existing labels kept",
+			pod:  productPod("es-core-gw", corev1.PodSpec{NodeSelector: map[string]string{"zone": "a"}}),
+			want: map[string]string{"pool": "es", "zone": "a"},
+		},
+		{
+			name: "conflicting value overridden",
+			pod:  productPod("es-core-gw", corev1.PodSpec{NodeSelector: map[string]string{"pool": "general"}}),
+			want: map[string]string{"pool": "es"},
+		},
+		{
+			name: "already pinned",
+			pod:  productPod("es-core-gw", corev1.PodSpec{NodeSelector: map[string]string{"pool": "es"}}),
+		},
+		{
+			name: "not an ES product",
+			pod:  productPod("", corev1.PodSpec{}),
+		},
+		{
+			name: "product without a node selector",
+			pod:  productPod("es-search", corev1.PodSpec{}),
+		},
+	}
+
+	mutator, err := NewPlacementMutator("es.io/product", PlacementNodeSelector, licensedSelector)
+	if err != nil {
+		t.Fatalf("NewPlacementMutator: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch := admit(t, mutator, tt.pod)
+			if tt.want == nil {
+				if patch != nil {
+					t.Errorf("patch = %+v, want none", patch)
+				}
+				return
+			}
+			if len(patch) != 1 || patch[0].Op != "add" || patch[0].Path != "/spec/nodeSelector" {
+				t.Fatalf("patch = %+v, want an add of /spec/nodeSelector", patch)
+			}
+			got, _ := json.Marshal(patch[0].Value)
+			want, _ := json.Marshal(tt.want)
+			if string(got) != string(want) {
+				t.Errorf("nodeSelector = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestPlacementAffinity(t *testing.T) {
+	pool := corev1.NodeSelectorRequirement{Key: "pool", Operator: corev1.NodeSelectorOpIn, Values: []string{"es"}}
+	zone := corev1.NodeSelectorRequirement{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}}
+	required := func(terms ...corev1.NodeSelectorTerm) corev1.PodSpec {
+		return corev1.PodSpec{Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: terms},
+		}}}
+	}
+	term := func(requirements ...corev1.NodeSelectorRequirement) corev1.NodeSelectorTerm {
+		return corev1.NodeSelectorTerm{MatchExpressions: requirements}
+	}
+
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+		want [][]corev1.NodeSelectorRequirement // match expressions per term, nil for no patch
+	}{
+		{
+			name: "pod without affinity",
+			pod:  productPod("es-core-gw", corev1.PodSpec{}),
+			want: [][]corev1.NodeSelectorRequirement{{pool}},
+		},
+		{
+			name: "requirement added to every term",
+			pod:  productPod("es-core-gw", required(term(zone), term())),
+			want: [][]corev1.NodeSelectorRequirement{{zone, pool}, {pool}},
+		},
+		{
+			name: "already required",
+			pod:  productPod("es-core-gw", required(term(pool))),
+		},
+	}
+
+	mutator, err := NewPlacementMutator("es.io/product", PlacementAffinity, licensedSelector)
+	if err != nil {
+		t.Fatalf("NewPlacementMutator: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch := admit(t, mutator, tt.pod)
+			if tt.want == nil {
+				if patch != nil {
+					t.Errorf("patch = %+v, want none", patch)
+				}
+				return
+			}
+			if len(patch) != 1 || patch[0].Op != "add" || patch[0].Path != "/spec/affinity" {
+				t.Fatalf("patch = %+v, want an add of /spec/affinity", patch)
+			}
+
+			raw, _ := json.Marshal(patch[0].Value)
+			var affinity corev1.Affinity
+			if err := json.Unmarshal(raw, &affinity); err != nil {
+				t.Fatalf("failed to decode affinity: %v", err)
+			}
+			terms := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+			got, _ := json.Marshal(terms)
+			want := make([]corev1.NodeSelectorTerm, len(tt.want))
+			for i, requirements := range tt.want {
+				want[i] = term(requirements...)
+			}
+			wantJSON, _ := json.Marshal(want)
+			if string(got) != string(wantJSON) {
+				t.Errorf("terms = %s, want %s", got, wantJSON)
+			}
+		})
+	}
+}
+
+func TestPlacementRejectsBadRequests(t *testing.T) {
+	mutator, err := NewPlacementMutator("es.io/product", PlacementNodeSelector, licensedSelector)
+	if err != nil {
+		t.Fatalf("NewPlacementMutator: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	mutator.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/mutate", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+
+	rec = httptest.NewRecorder()
+	mutator.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mutate", bytes.NewReader([]byte(`{"kind": "AdmissionReview"}`))))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("review without request: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	if _, err := NewPlacementMutator("es.io/product", "taints", licensedSelector); err == nil {
+		t.Error("NewPlacementMutator accepted an unknown placement")
+	}
+}
@@ -0,0 +1,124 @@
+package workloads
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/enterprisesight/es-license-validator/pkg/license"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// NodeMatcher reports whether a node matches a license node selector
+type NodeMatcher interface {
+	NodeMatches(name string, selector map[string]string) bool
+}
+
+// Auditor checks where ES product pods run. Pods carrying the product label
+// are watched across all namespaces and compared against the nodes the
+// product's license counts.
+type Auditor struct {
+	productLabel string
+	nodes        NodeMatcher
+	factory      informers.SharedInformerFactory
+	informer     cache.SharedIndexInformer
+	lister       listersv1.PodLister
+}
+
+// NewAuditor creates an auditor for pods labeled with productLabel, whose
+// value is the product code
+func NewAuditor(clientset kubernetes.Interface, productLabel string, nodes NodeMatcher) (*Auditor, error) {
+	selector, err := labels.Parse(productLabel)
+	if err != nil {
+		return nil, fmt.Errorf("invalid product label %q: %w", productLabel, err)
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = selector.String()
+		}),
+	)
+	podInformer := factory.Core().V1().Pods()
+
+	return &Auditor{
+		productLabel: productLabel,
+		nodes:        nodes,
+		factory:      factory,
+		informer:     podInformer.Informer(),
+		lister:       podInformer.Lister(),
+	}, nil
+}
+
+// OnChange registers a callback invoked whenever a product pod is scheduled,
+// relabeled or deleted. Must be called before Start.
+func (a *Auditor) OnChange(fn func()) error {
+	_, err := a.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			fn()
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldPod, okOld := oldObj.(*corev1.Pod)
+			newPod, okNew := newObj.(*corev1.Pod)
+			// Ignore status updates; only scheduling and labels affect the audit
+			if okOld && okNew && oldPod.Spec.NodeName == newPod.Spec.NodeName &&
+				oldPod.Labels[a.productLabel] == newPod.Labels[a.productLabel] {
+				return
+			}
+			fn()
+		},
+		DeleteFunc: func(obj interface{}) {
+			fn()
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add pod event handler: %w", err)
+	}
+	return nil
+}
+
+// Start starts the pod informer and waits for its cache to sync
+func (a *Auditor) Start(ctx context.Context) error {
+	a.factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), a.informer.HasSynced) {
+		return fmt.Errorf("failed to sync pod cache")
+	}
+	return nil
+}
+
+// Audit lists the running pods of a product and flags those scheduled on a
+// node that does not match the product's node selector
+func (a *Auditor) Audit(productCode string, selector map[string]string) (license.PlacementAudit, error) {
+	audit := license.PlacementAudit{}
+
+	pods, err := a.lister.List(labels.SelectorFromSet(labels.Set{a.productLabel: productCode}))
+	if err != nil {
+		return audit, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	nodes := make(map[string]struct{})
+	for _, pod := range pods {
+		if pod.Spec.NodeName == "" || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		audit.Pods++
+		if a.nodes.NodeMatches(pod.Spec.NodeName, selector) {
+			continue
+		}
+		audit.UnlicensedPods = append(audit.UnlicensedPods, pod.Namespace+"/"+pod.Name)
+		nodes[pod.Spec.NodeName] = struct{}{}
+	}
+
+	for node := range nodes {
+		audit.UnlicensedNodes = append(audit.UnlicensedNodes, node)
+	}
+	sort.Strings(audit.UnlicensedPods)
+	sort.Strings(audit.UnlicensedNodes)
+	return audit, nil
+}